@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Result values recorded for an operation.
+const (
+	ResultOK        = "ok"
+	ResultError     = "error"
+	ResultCancelled = "cancelled" // a confirmation prompt was declined
+	ResultNoop      = "noop"      // nothing needed changing, e.g. the database already existed
+)
+
+// Entry is one line of the audit log.
+type Entry struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Host     string    `json:"host"`
+	Engine   string    `json:"engine,omitempty"`
+	Server   string    `json:"server,omitempty"`
+	Command  string    `json:"command"`
+	Args     []string  `json:"args,omitempty"`
+	Result   string    `json:"result"`
+	DryRun   bool      `json:"dry_run,omitempty"` // the commands were only printed
+	Error    string    `json:"error,omitempty"`
+	Duration float64   `json:"duration_seconds"`
+}
+
+// Dir returns $XDG_STATE_HOME/awesome-shell, or ~/.local/state/awesome-shell when XDG_STATE_HOME is unset.
+func Dir() string {
+	if d := os.Getenv("XDG_STATE_HOME"); d != "" {
+		return filepath.Join(d, "awesome-shell")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "awesome-shell")
+	}
+	return filepath.Join(home, ".local", "state", "awesome-shell")
+}
+
+// Path returns the audit log file.
+func Path() string {
+	return filepath.Join(Dir(), "audit.jsonl")
+}
+
+// NewEntry returns an entry stamped with the current time, OS user and host.
+func NewEntry(command string) Entry {
+	e := Entry{Time: time.Now().UTC(), Command: command, User: os.Getenv("USER")}
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	e.Host, _ = os.Hostname()
+	return e
+}
+
+// Append writes e as one JSON line; the file is only ever appended to.
+func Append(e Entry) error {
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(Path(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read returns the entries for which keep returns true, oldest first. Malformed lines are skipped.
+func Read(keep func(Entry) bool) ([]Entry, error) {
+	f, err := os.Open(Path())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var out []Entry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for sc.Scan() {
+		var e Entry
+		if json.Unmarshal(sc.Bytes(), &e) != nil {
+			continue
+		}
+		if keep == nil || keep(e) {
+			out = append(out, e)
+		}
+	}
+	return out, sc.Err()
+}
+
+// IsSecret reports whether a flag name holds a credential that must not be logged.
+func IsSecret(flag string) bool {
+	flag = strings.ToLower(strings.TrimLeft(flag, "-"))
+	for _, s := range []string{"password", "passwd", "secret", "token"} {
+		if strings.Contains(flag, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted is logged in place of secret values.
+const Redacted = "***"
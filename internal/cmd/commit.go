@@ -4,9 +4,9 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	osexec "os/exec"
 	"strings"
 
+	"github.com/sichang824/awesome-shell/internal/exec"
 	"github.com/spf13/cobra"
 )
 
@@ -25,21 +25,20 @@ func init() {
 
 func runCommit(cmd *cobra.Command, args []string) error {
 	// git status -s
-	statusOut, err := osexec.Command("git", "status", "-s").Output()
+	statusOut, _, err := exec.RunReadOnly("git", "status", "-s")
 	if err != nil {
 		return err
 	}
 	// git diff --staged
-	diffOut, _ := osexec.Command("git", "diff", "--staged").Output()
-	prompt := fmt.Sprintf("Changes:\n%s\n\nChange Contents:\n%s", string(statusOut), string(diffOut))
+	diffOut, _, _ := exec.RunReadOnly("git", "diff", "--staged")
+	prompt := fmt.Sprintf("Changes:\n%s\n\nChange Contents:\n%s", statusOut, diffOut)
 	// ollama run model generate "prompt"
-	c := osexec.Command("ollama", "run", commitModel, "generate", prompt)
-	c.Stderr = os.Stderr
-	out, err := c.Output()
+	out, stderr, err := exec.RunReadOnly("ollama", "run", commitModel, "generate", prompt)
 	if err != nil {
+		fmt.Fprint(os.Stderr, stderr)
 		return err
 	}
-	msg := strings.TrimSpace(string(out))
+	msg := strings.TrimSpace(out)
 	fmt.Println("\nGenerated commit message:\n" + msg)
 	fmt.Print("Commit now? (y/n) ")
 	scanner := bufio.NewScanner(os.Stdin)
@@ -49,9 +48,6 @@ func runCommit(cmd *cobra.Command, args []string) error {
 	if strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
 		return nil
 	}
-	osexec.Command("git", "add", ".").Run()
-	c2 := osexec.Command("git", "commit", "-m", msg)
-	c2.Stdout = os.Stdout
-	c2.Stderr = os.Stderr
-	return c2.Run()
+	exec.Run("git", "add", ".")
+	return exec.RunInherit("git", "commit", "-m", msg)
 }
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
@@ -9,10 +10,13 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/sichang824/awesome-shell/internal/config"
 	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
 	"github.com/spf13/cobra"
 	"github.com/go-sql-driver/mysql"
 )
@@ -20,11 +24,23 @@ import (
 var dbCmd = &cobra.Command{
 	Use:   "db",
 	Short: "Database operations (MySQL, PostgreSQL, MongoDB) via native connection",
-	Long:  "Connect with --host, --port, --user, --password. No docker required.",
+	Long: `Connect with --host, --port, --user, --password. No docker required.
+Settings not given by flags or the environment are taken from the mysql/postgres/mongo service
+of the nearest compose file (its published port and root credentials); pick one with --service.
+With --via-compose <service> everything runs through docker compose exec with the container's own
+mysql/psql/mongosh, for services that publish no port.`,
 }
 
+// Result display options shared by the SQL REPLs.
+var (
+	dbNullDisplay, dbTimeZone, dbBinaryMode string
+)
+
 func init() {
 	config.LoadEnv()
+	dbCmd.PersistentFlags().StringVar(&dbNullDisplay, "null-display", "NULL", "text shown for NULL values in query results")
+	dbCmd.PersistentFlags().StringVar(&dbTimeZone, "time-zone", "", "time zone for TIMESTAMP/TIMESTAMPTZ values in query results (default local)")
+	dbCmd.PersistentFlags().StringVar(&dbBinaryMode, "binary", db.BinaryTruncate, "binary column display: hex or truncate")
 	dbCmd.AddCommand(dbGenPasswordCmd, mysqlCmd, pgsqlCmd, mongoCmd)
 }
 
@@ -39,8 +55,27 @@ func genPassword() string {
 	return s
 }
 
+// humanBytes formats a byte count with a binary unit suffix (e.g. 1.5 MiB).
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// confirm asks the user to type expected; see assumeYes for when the prompt is skipped.
 func confirm(prompt, expected string) bool {
 	fmt.Print(prompt)
+	if assumeYes() {
+		fmt.Println(expected + " (--yes)")
+		return true
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	if !scanner.Scan() {
 		return false
@@ -48,6 +83,23 @@ func confirm(prompt, expected string) bool {
 	return strings.TrimSpace(scanner.Text()) == expected
 }
 
+// sqlSession is a *sql.DB, or a *sql.Conn when statements rely on session state (USE, SET ...).
+type sqlSession interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// execSQL runs a statement that changes the server, or only prints it under --dry-run.
+func execSQL(conn sqlSession, query string) error {
+	if exec.DryRun {
+		fmt.Println("[dry-run]", query+";")
+		return nil
+	}
+	_, err := conn.ExecContext(dbCtx, query)
+	return err
+}
+
 // safeIdent allows alphanumeric, underscore, and hyphen for SQL identifiers (e.g. expert-dev); avoids injection when quoted.
 var safeIdent = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
 
@@ -96,14 +148,15 @@ func getMySQLConfig() db.MySQLConfig {
 	port := os.Getenv("MYSQL_PORT")
 	pw := os.Getenv("MYSQL_ROOT_PASSWORD")
 	config.LoadEnv()
+	cs := composeDefaults(mysqlCmd, "mysql", "MYSQL_HOST", "MYSQL_PORT")
 	if host == "" {
-		host = config.GetEnv("MYSQL_HOST", mysqlHost)
+		host = config.GetEnv("MYSQL_HOST", flagOr(mysqlCmd, "host", cs.Host))
 	}
 	if host == "" {
 		host = "127.0.0.1"
 	}
 	if port == "" {
-		port = config.GetEnv("MYSQL_PORT", mysqlPort)
+		port = config.GetEnv("MYSQL_PORT", flagOr(mysqlCmd, "port", cs.Port))
 	}
 	if port == "" {
 		port = "3306"
@@ -112,7 +165,7 @@ func getMySQLConfig() db.MySQLConfig {
 		pw = mysqlPassword
 	}
 	if pw == "" {
-		pw = config.GetEnv("MYSQL_ROOT_PASSWORD", "")
+		pw = config.GetEnv("MYSQL_ROOT_PASSWORD", cs.Password)
 	}
 	return db.MySQLConfig{
 		Host:     host,
@@ -124,19 +177,74 @@ func getMySQLConfig() db.MySQLConfig {
 }
 
 func openMySQL(cfg db.MySQLConfig) (*sql.DB, error) {
+	if dbViaCompose != "" {
+		return openComposeSQL("mysql", cfg.User, cfg.Password, cfg.Database), nil
+	}
 	mc := &mysql.Config{
-		User:                 cfg.User,
-		Passwd:               cfg.Password,
-		Net:                  "tcp",
-		Addr:                 cfg.Host + ":" + cfg.Port,
-		DBName:               cfg.Database,
-		AllowNativePasswords: true, // required for MariaDB / mysql_native_password
+		User:                    cfg.User,
+		Passwd:                  cfg.Password,
+		Net:                     "tcp",
+		Addr:                    cfg.Host + ":" + cfg.Port,
+		DBName:                  cfg.Database,
+		AllowNativePasswords:    true, // required for MariaDB / mysql_native_password
 		AllowCleartextPasswords: true,
-		TLSConfig:            "false", // skip TLS for local/docker
+		TLSConfig:               "false", // skip TLS for local/docker
+		Timeout:                 dbConnectTimeout,
+	}
+	t, err := sshTunnel()
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		mysql.RegisterDialContext(mysqlSSHNet, dialMySQLTunnel(t))
+		mc.Net = mysqlSSHNet
+	}
+	if dbStatementTimeout > 0 {
+		connector, err := mysql.NewConnector(mc)
+		if err != nil {
+			return nil, err
+		}
+		return sql.OpenDB(mysqlTimeoutConnector{connector, dbStatementTimeout}), nil
 	}
 	return sql.Open("mysql", mc.FormatDSN())
 }
 
+func mysqlDBExists(conn *sql.DB, name string) (bool, error) {
+	var exists int
+	err := conn.QueryRowContext(dbCtx, "SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", name).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// mysqlUserExists reports whether the account username@host exists, or with an empty host any account of username.
+func mysqlUserExists(conn *sql.DB, username, host string) (bool, error) {
+	var count int
+	err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM mysql.user WHERE user = ? AND (host = ? OR ? = '')", username, host, host).Scan(&count)
+	return count > 0, err
+}
+
+func mysqlCreateDatabase(conn *sql.DB, name string, opts mysqlDatabaseOptions) error {
+	return execSQL(conn, "CREATE DATABASE IF NOT EXISTS `"+name+"`"+opts.clauses())
+}
+
+func mysqlCreateUser(conn *sql.DB, username, host, pw string, opts mysqlAccountOptions) error {
+	stmt, err := mysqlCreateUserStatement(conn, username, host, pw, opts)
+	if err != nil {
+		return err
+	}
+	return execSQL(conn, stmt)
+}
+
+func mysqlGrant(conn *sql.DB, database, username, host, preset string) error {
+	err := execSQL(conn, "GRANT "+mysqlPresetPrivileges[preset]+" ON `"+database+"`.* TO "+mysqlAccount(username, host))
+	if err != nil {
+		return err
+	}
+	return execSQL(conn, "FLUSH PRIVILEGES")
+}
+
 var (
 	mysqlCreateDBCmd = &cobra.Command{
 		Use:   "create-db [database]",
@@ -164,7 +272,7 @@ var (
 	}
 	mysqlGrantCmd = &cobra.Command{
 		Use:   "grant [database] [username]",
-		Short: "Grant all on database to user",
+		Short: "Grant privileges on database to user (--preset, default owner = all)",
 		Args:  cobra.ExactArgs(2),
 		RunE:  runMysqlGrant,
 	}
@@ -220,17 +328,18 @@ func runMysqlCreateDB(cmd *cobra.Command, args []string) error {
 	}
 	defer conn.Close()
 
-	var exists int
-	err = conn.QueryRow("SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", database).Scan(&exists)
-	if err == nil {
-		fmt.Println("Database '" + database + "' already exists.")
-		return nil
+	exists, err := mysqlDBExists(conn, database)
+	if err != nil {
+		return err
 	}
-	if err != sql.ErrNoRows {
+	if exists {
+		return noop("Database '" + database + "' already exists.")
+	}
+	opts := mysqlDatabaseOptions{charset: mysqlDBCharset, collation: mysqlDBCollation}
+	if err := opts.validate(conn); err != nil {
 		return err
 	}
-	_, err = conn.Exec("CREATE DATABASE IF NOT EXISTS `" + database + "`")
-	if err != nil {
+	if err := mysqlCreateDatabase(conn, database, opts); err != nil {
 		return err
 	}
 	fmt.Println("Database '" + database + "' created.")
@@ -241,6 +350,18 @@ func runMysqlCreateUser(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[0], "username"); err != nil {
 		return err
 	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
+	opts := mysqlAccountOptions{
+		plugin:         mysqlAuthPlugin,
+		requireSSL:     mysqlRequireSSL,
+		maxConnections: mysqlMaxConns,
+		passwordExpire: mysqlPwExpire,
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
 	username := args[0]
 	pw := genPassword()
 	cfg := getMySQLConfig()
@@ -250,22 +371,17 @@ func runMysqlCreateUser(cmd *cobra.Command, args []string) error {
 	}
 	defer conn.Close()
 
-	var count int
-	err = conn.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE user = ?", username).Scan(&count)
+	exists, err := mysqlUserExists(conn, username, mysqlAccountHost)
 	if err != nil {
 		return err
 	}
-	if count > 0 {
-		fmt.Println("User '" + username + "' already exists.")
-		return nil
+	if exists {
+		return noop("User '" + username + "@" + mysqlAccountHost + "' already exists.")
 	}
-	// MySQL does not support placeholders for identifiers in CREATE USER
-	pwEsc := strings.ReplaceAll(pw, "'", "''")
-	_, err = conn.Exec("CREATE USER IF NOT EXISTS `" + username + "`@'%' IDENTIFIED BY '" + pwEsc + "'")
-	if err != nil {
+	if err := mysqlCreateUser(conn, username, mysqlAccountHost, pw, opts); err != nil {
 		return err
 	}
-	fmt.Println("User:", username)
+	fmt.Println("User:", username+"@"+mysqlAccountHost)
 	fmt.Println("Password:", pw)
 	fmt.Println("Save this password.")
 	return nil
@@ -276,6 +392,9 @@ func runMysqlDeleteDB(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	database := args[0]
+	if err := guardDrop("database", database, mysqlSystemDatabases[database]); err != nil {
+		return err
+	}
 	cfg := getMySQLConfig()
 	conn, err := openMySQL(cfg)
 	if err != nil {
@@ -284,19 +403,24 @@ func runMysqlDeleteDB(cmd *cobra.Command, args []string) error {
 	defer conn.Close()
 
 	var exists int
-	err = conn.QueryRow("SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", database).Scan(&exists)
+	err = conn.QueryRowContext(dbCtx, "SELECT 1 FROM information_schema.schemata WHERE schema_name = ?", database).Scan(&exists)
 	if err == sql.ErrNoRows {
-		fmt.Println("Database '" + database + "' does not exist.")
-		return nil
+		return noop("Database '" + database + "' does not exist.")
 	}
 	if err != nil {
 		return err
 	}
 	if !confirm("Type database name to confirm: ", database) {
-		fmt.Println("Cancelled.")
-		return nil
+		return cancelled()
 	}
-	_, err = conn.Exec("DROP DATABASE `" + database + "`")
+	if !dbNoBackup {
+		if err := backupToTrash("mysql", database, mysqlDumpFile, func(e *trash.Entry) error {
+			return dumpMySQLDatabase(cfg, database, e)
+		}); err != nil {
+			return err
+		}
+	}
+	err = execSQL(conn, "DROP DATABASE `"+database+"`")
 	if err != nil {
 		return err
 	}
@@ -308,28 +432,31 @@ func runMysqlDeleteUser(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[0], "username"); err != nil {
 		return err
 	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
 	username := args[0]
 	cfg := getMySQLConfig()
+	if err := guardDrop("user", username, mysqlSystemUsers[username] || username == cfg.User); err != nil {
+		return err
+	}
 	conn, err := openMySQL(cfg)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	var count int
-	err = conn.QueryRow("SELECT COUNT(*) FROM mysql.user WHERE user = ?", username).Scan(&count)
+	exists, err := mysqlUserExists(conn, username, mysqlAccountHost)
 	if err != nil {
 		return err
 	}
-	if count == 0 {
-		fmt.Println("User '" + username + "' does not exist.")
-		return nil
+	if !exists {
+		return noop("User '" + username + "@" + mysqlAccountHost + "' does not exist.")
 	}
 	if !confirm("Type username to confirm: ", username) {
-		fmt.Println("Cancelled.")
-		return nil
+		return cancelled()
 	}
-	_, err = conn.Exec("DROP USER `" + username + "`@'%'")
+	err = execSQL(conn, "DROP USER "+mysqlAccount(username, mysqlAccountHost))
 	if err != nil {
 		return err
 	}
@@ -344,6 +471,12 @@ func runMysqlGrant(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[1], "username"); err != nil {
 		return err
 	}
+	if err := checkPreset(mysqlGrantPreset); err != nil {
+		return err
+	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
 	database, username := args[0], args[1]
 	cfg := getMySQLConfig()
 	conn, err := openMySQL(cfg)
@@ -352,12 +485,7 @@ func runMysqlGrant(cmd *cobra.Command, args []string) error {
 	}
 	defer conn.Close()
 
-	_, err = conn.Exec("GRANT ALL PRIVILEGES ON `" + database + "`.* TO `" + username + "`@'%'")
-	if err != nil {
-		return err
-	}
-	_, err = conn.Exec("FLUSH PRIVILEGES")
-	if err != nil {
+	if err := mysqlGrant(conn, database, username, mysqlAccountHost, mysqlGrantPreset); err != nil {
 		return err
 	}
 	fmt.Println("Granted.")
@@ -371,7 +499,7 @@ func runMysqlDbs(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer conn.Close()
-	rows, err := conn.Query("SELECT schema_name FROM information_schema.schemata ORDER BY schema_name")
+	rows, err := conn.QueryContext(dbCtx, "SELECT schema_name FROM information_schema.schemata ORDER BY schema_name")
 	if err != nil {
 		return err
 	}
@@ -386,66 +514,105 @@ func runMysqlDbs(cmd *cobra.Command, args []string) error {
 	return rows.Err()
 }
 
-func runMysqlUsers(cmd *cobra.Command, args []string) error {
+func runMysqlTables(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	database := args[0]
 	cfg := getMySQLConfig()
+	cfg.Database = database
 	conn, err := openMySQL(cfg)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
-	rows, err := conn.Query("SELECT user, host FROM mysql.user ORDER BY user, host")
+	rows, err := conn.QueryContext(dbCtx, "SELECT table_name FROM information_schema.tables WHERE table_schema = ? ORDER BY table_name", database)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 	for rows.Next() {
-		var user, host string
-		if err := rows.Scan(&user, &host); err != nil {
+		var name string
+		if err := rows.Scan(&name); err != nil {
 			return err
 		}
-		fmt.Printf("%s@%s\n", user, host)
+		fmt.Println(name)
 	}
 	return rows.Err()
 }
 
-func runMysqlTables(cmd *cobra.Command, args []string) error {
-	if err := requireSafeIdent(args[0], "database"); err != nil {
+// newValueFormatter builds the result formatter for engine ("mysql" or "postgres") from the --null-display, --time-zone and --binary flags.
+func newValueFormatter(engine string) (*db.ValueFormatter, error) {
+	loc := time.Local
+	if dbTimeZone != "" {
+		l, err := time.LoadLocation(dbTimeZone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --time-zone %q: %w", dbTimeZone, err)
+		}
+		loc = l
+	}
+	if dbBinaryMode != db.BinaryHex && dbBinaryMode != db.BinaryTruncate {
+		return nil, fmt.Errorf("invalid --binary %q (use hex or truncate)", dbBinaryMode)
+	}
+	return &db.ValueFormatter{
+		Engine:    engine,
+		Null:      dbNullDisplay,
+		Location:  loc,
+		Binary:    dbBinaryMode,
+		MaxBinary: 32,
+	}, nil
+}
+
+// printSQLRows prints a header line and tab-separated rows, rendering each value by its column type.
+func printSQLRows(rows *sql.Rows, f *db.ValueFormatter) error {
+	cols, err := rows.Columns()
+	if err != nil || len(cols) == 0 {
 		return err
 	}
-	database := args[0]
-	cfg := getMySQLConfig()
-	cfg.Database = database
-	conn, err := openMySQL(cfg)
+	types, err := rows.ColumnTypes()
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	rows, err := conn.Query("SELECT table_name FROM information_schema.tables WHERE table_schema = ? ORDER BY table_name", database)
-	if err != nil {
-		return err
+	fmt.Println(strings.Join(cols, "\t"))
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
 	}
-	defer rows.Close()
 	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
+		if err := rows.Scan(ptrs...); err != nil {
 			return err
 		}
-		fmt.Println(name)
+		parts := make([]string, len(cols))
+		for i, v := range vals {
+			parts[i] = f.Format(types[i], v)
+		}
+		fmt.Println(strings.Join(parts, "\t"))
 	}
 	return rows.Err()
 }
 
 func runMySQLREPL(conn *sql.DB) error {
+	f, err := newValueFormatter("mysql")
+	if err != nil {
+		return err
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	var buf strings.Builder
-	fmt.Fprintln(os.Stderr, "Go driver REPL (\\q to quit)")
+	session, err := openSQLREPLSession(conn, "SELECT CONNECTION_ID()", "KILL QUERY %d")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	f.SessionZone = mysqlSessionZone(session.conn)
+	fmt.Fprintln(os.Stderr, "Go driver REPL (\\q to quit, Ctrl-C cancels the running statement)")
 	for {
 		if buf.Len() > 0 {
 			fmt.Fprint(os.Stderr, "... ")
 		} else {
 			fmt.Fprint(os.Stderr, "mysql> ")
 		}
-		if !scanner.Scan() {
+		if !scanREPLLine(scanner) {
 			break
 		}
 		line := scanner.Text()
@@ -468,53 +635,37 @@ func runMySQLREPL(conn *sql.DB) error {
 		if stmt == "" {
 			continue
 		}
-		rows, err := conn.Query(stmt)
-		if err != nil {
-			result, execErr := conn.Exec(stmt)
-			if execErr != nil {
-				fmt.Fprintln(os.Stderr, "ERROR:", err)
-				continue
-			}
-			affected, _ := result.RowsAffected()
-			fmt.Println("OK", affected, "row(s) affected")
-			continue
-		}
-		cols, _ := rows.Columns()
-		if len(cols) == 0 {
-			_ = rows.Close()
-			continue
-		}
-		fmt.Println(strings.Join(cols, "\t"))
-		vals := make([]interface{}, len(cols))
-		ptrs := make([]interface{}, len(cols))
-		for i := range vals {
-			ptrs[i] = &vals[i]
-		}
-		for rows.Next() {
-			if err := rows.Scan(ptrs...); err != nil {
-				fmt.Fprintln(os.Stderr, "ERROR:", err)
-				break
-			}
-			parts := make([]string, len(cols))
-			for i, v := range vals {
-				if v == nil {
-					parts[i] = "NULL"
-				} else {
-					parts[i] = fmt.Sprint(v)
-				}
-			}
-			fmt.Println(strings.Join(parts, "\t"))
+		session.run(stmt, f)
+		if dbCtx.Err() != nil {
+			return dbCtx.Err()
 		}
-		if err := rows.Err(); err != nil {
-			fmt.Fprintln(os.Stderr, "ERROR:", err)
+		if strings.Contains(strings.ToLower(stmt), "time_zone") {
+			f.SessionZone = mysqlSessionZone(session.conn)
 		}
-		_ = rows.Close()
 	}
 	return scanner.Err()
 }
 
+// mysqlSessionZone returns the time zone of the session on c, in which the server returns TIMESTAMP values,
+// or nil when it cannot be read.
+func mysqlSessionZone(c *sql.Conn) *time.Location {
+	var name string
+	var offset int
+	if err := c.QueryRowContext(dbCtx, "SELECT @@session.time_zone, TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), NOW())").Scan(&name, &offset); err != nil {
+		return nil
+	}
+	// Named zones follow their DST rules; SYSTEM and +hh:mm zones are taken at their current offset.
+	if l, err := time.LoadLocation(name); err == nil && name != "" {
+		return l
+	}
+	return time.FixedZone("", offset)
+}
+
 func runMysqlClient(cmd *cobra.Command, args []string) error {
 	cfg := getMySQLConfig()
+	if dbViaCompose != "" {
+		return runComposeClient("mysql", cfg.User, cfg.Password, "")
+	}
 	conn, err := openMySQL(cfg)
 	if err != nil {
 		return err
@@ -534,6 +685,9 @@ func runMysqlLogin(cmd *cobra.Command, args []string) error {
 	if cfg.User == "" {
 		return fmt.Errorf("username required: pass [username] [password] or use --user and --password (or set MYSQL_ROOT_PASSWORD)")
 	}
+	if dbViaCompose != "" {
+		return runComposeClient("mysql", cfg.User, cfg.Password, "")
+	}
 	conn, err := openMySQL(cfg)
 	if err != nil {
 		return err
@@ -0,0 +1,738 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/sichang824/awesome-shell/internal/config"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	applyFile, applyCredentials string
+	applyPlanOnly, applyPrune   bool
+)
+
+var dbApplyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "Provision databases, users, grants, schemas and extensions from a YAML spec",
+	Long: `Read a YAML spec, compare it with the live servers and apply only what is missing.
+
+  mysql:
+    databases: [{name: app}]
+    users: [{name: app}]
+    grants: [{user: app, database: app, preset: readwrite}]
+  postgres:
+    databases: [{name: app, owner: app}]
+    users: [{name: app}]
+    grants: [{user: app, database: app, preset: owner}]
+    schemas: [{database: app, name: billing, owner: app}]
+    extensions: [{database: app, name: pgcrypto}]
+  mongo:
+    databases: [{name: app}]
+    users: [{name: app}]
+    grants: [{user: app, database: app, preset: readwrite}]   # or role: dbAdmin
+
+Passwords generated for new users are written to --credentials.
+With --prune, databases and users on those servers that are not declared are dropped
+(system databases, system users and the connecting user are never pruned). Each pruned database is
+first backed up into the trash, as delete-db does (skip with --no-backup).`,
+	Args: cobra.NoArgs,
+	RunE: runDBApply,
+}
+
+func init() {
+	dbApplyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "YAML spec file")
+	dbApplyCmd.Flags().StringVar(&applyCredentials, "credentials", "credentials.env", "file that receives generated passwords")
+	dbApplyCmd.Flags().BoolVar(&applyPlanOnly, "plan", false, "only print the plan")
+	dbApplyCmd.Flags().BoolVar(&applyPrune, "prune", false, "drop undeclared databases and users (asks for confirmation)")
+	_ = dbApplyCmd.MarkFlagRequired("file")
+	dbCmd.AddCommand(dbApplyCmd)
+}
+
+type applySpec struct {
+	MySQL    *applyEngineSpec `yaml:"mysql"`
+	Postgres *applyEngineSpec `yaml:"postgres"`
+	Mongo    *applyEngineSpec `yaml:"mongo"`
+}
+
+type applyEngineSpec struct {
+	Databases []struct {
+		Name  string `yaml:"name"`
+		Owner string `yaml:"owner"`
+	} `yaml:"databases"`
+	Users []struct {
+		Name string `yaml:"name"`
+	} `yaml:"users"`
+	Grants []struct {
+		User     string `yaml:"user"`
+		Database string `yaml:"database"`
+		Preset   string `yaml:"preset"`
+		Role     string `yaml:"role"`
+	} `yaml:"grants"`
+	Schemas []struct {
+		Database string `yaml:"database"`
+		Name     string `yaml:"name"`
+		Owner    string `yaml:"owner"`
+	} `yaml:"schemas"`
+	Extensions []struct {
+		Database string `yaml:"database"`
+		Name     string `yaml:"name"`
+	} `yaml:"extensions"`
+}
+
+// validate checks names and presets before anything touches a server.
+func (s *applyEngineSpec) validate(engine string) error {
+	for _, d := range s.Databases {
+		if err := requireSafeIdent(d.Name, "database"); err != nil {
+			return fmt.Errorf("%s: %w", engine, err)
+		}
+		if d.Owner != "" {
+			if err := requireSafeIdent(d.Owner, "owner"); err != nil {
+				return fmt.Errorf("%s: %w", engine, err)
+			}
+		}
+	}
+	for _, u := range s.Users {
+		if err := requireSafeIdent(u.Name, "username"); err != nil {
+			return fmt.Errorf("%s: %w", engine, err)
+		}
+	}
+	for _, g := range s.Grants {
+		if err := requireSafeIdent(g.User, "username"); err != nil {
+			return fmt.Errorf("%s grant: %w", engine, err)
+		}
+		if err := requireSafeIdent(g.Database, "database"); err != nil {
+			return fmt.Errorf("%s grant: %w", engine, err)
+		}
+		if g.Role != "" && engine != "mongo" {
+			return fmt.Errorf("%s grant for %s: role is only supported for mongo, use preset", engine, g.User)
+		}
+		if g.Role == "" {
+			preset := g.Preset
+			if preset == "" {
+				preset = presetOwner
+			}
+			if err := checkPreset(preset); err != nil {
+				return fmt.Errorf("%s grant for %s: %w", engine, g.User, err)
+			}
+		}
+	}
+	if engine != "postgres" && (len(s.Schemas) > 0 || len(s.Extensions) > 0) {
+		return fmt.Errorf("%s: schemas and extensions are only supported for postgres", engine)
+	}
+	for _, sc := range s.Schemas {
+		if err := requireSafeIdent(sc.Database, "database"); err != nil {
+			return fmt.Errorf("%s schema: %w", engine, err)
+		}
+		if err := requireSafeIdent(sc.Name, "schema"); err != nil {
+			return fmt.Errorf("%s schema: %w", engine, err)
+		}
+	}
+	for _, e := range s.Extensions {
+		if err := requireSafeIdent(e.Database, "database"); err != nil {
+			return fmt.Errorf("%s extension: %w", engine, err)
+		}
+		if err := requireSafeIdent(e.Name, "extension"); err != nil {
+			return fmt.Errorf("%s extension: %w", engine, err)
+		}
+	}
+	return nil
+}
+
+func (s *applyEngineSpec) declaredDatabases() map[string]bool {
+	m := map[string]bool{}
+	for _, d := range s.Databases {
+		m[d.Name] = true
+	}
+	return m
+}
+
+func (s *applyEngineSpec) declaredUsers() map[string]bool {
+	m := map[string]bool{}
+	for _, u := range s.Users {
+		m[u.Name] = true
+	}
+	return m
+}
+
+// applyAction is one step of the plan.
+type applyAction struct {
+	engine, desc string
+	prune        bool
+	run          func() error
+}
+
+// applyCredential is a generated password to be written to the credentials file.
+type applyCredential struct {
+	key, password string
+}
+
+// applyPlan collects actions, generated credentials and connections to close when done.
+type applyPlan struct {
+	actions     []applyAction
+	credentials []applyCredential
+	closers     []func()
+}
+
+func (p *applyPlan) add(engine, desc string, run func() error) {
+	p.actions = append(p.actions, applyAction{engine: engine, desc: desc, run: run})
+}
+
+func (p *applyPlan) addPrune(engine, desc string, run func() error) {
+	p.actions = append(p.actions, applyAction{engine: engine, desc: desc, prune: true, run: run})
+}
+
+// credentialKey names a generated password in the credentials file, e.g. MYSQL_APP_PASSWORD.
+func credentialKey(engine, user string) string {
+	return strings.ToUpper(engine + "_" + strings.ReplaceAll(user, "-", "_") + "_PASSWORD")
+}
+
+func runDBApply(cmd *cobra.Command, args []string) error {
+	if err := refuseViaCompose(cmd.CommandPath()); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(applyFile)
+	if err != nil {
+		return err
+	}
+	var spec applySpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("%s: %w", applyFile, err)
+	}
+	for engine, s := range map[string]*applyEngineSpec{"mysql": spec.MySQL, "postgres": spec.Postgres, "mongo": spec.Mongo} {
+		if s != nil {
+			if err := s.validate(engine); err != nil {
+				return err
+			}
+		}
+	}
+
+	plan := &applyPlan{}
+	defer func() {
+		for _, c := range plan.closers {
+			c()
+		}
+	}()
+	if spec.MySQL != nil {
+		if err := planMySQL(plan, spec.MySQL); err != nil {
+			return fmt.Errorf("mysql: %w", err)
+		}
+	}
+	if spec.Postgres != nil {
+		if err := planPostgres(plan, spec.Postgres); err != nil {
+			return fmt.Errorf("postgres: %w", err)
+		}
+	}
+	if spec.Mongo != nil {
+		if err := planMongo(plan, spec.Mongo); err != nil {
+			return fmt.Errorf("mongo: %w", err)
+		}
+	}
+
+	if len(plan.actions) == 0 {
+		return noop("Nothing to do: servers match the spec.")
+	}
+	fmt.Println("Plan:")
+	prunes := 0
+	for _, a := range plan.actions {
+		mark := "+"
+		if a.prune {
+			mark = "-"
+			prunes++
+		}
+		fmt.Printf("  %s [%s] %s\n", mark, a.engine, a.desc)
+	}
+	if applyPlanOnly {
+		return nil
+	}
+	if prunes > 0 && !confirm(fmt.Sprintf("%d object(s) will be dropped. Type 'prune' to confirm: ", prunes), "prune") {
+		return cancelled()
+	}
+	// Write credentials before creating users so a failed run never loses a password that was applied.
+	for _, c := range plan.credentials {
+		if exec.DryRun {
+			fmt.Println("[dry-run] set", c.key, "in", applyCredentials)
+			continue
+		}
+		if err := config.SetEnvValue(applyCredentials, c.key, c.password); err != nil {
+			return err
+		}
+	}
+	if len(plan.credentials) > 0 && !exec.DryRun {
+		fmt.Printf("Wrote %d generated password(s) to %s\n", len(plan.credentials), applyCredentials)
+	}
+	for i, a := range plan.actions {
+		if err := a.run(); err != nil {
+			return fmt.Errorf("[%s] %s: %w (%d of %d steps applied)", a.engine, a.desc, err, i, len(plan.actions))
+		}
+		fmt.Printf("  done [%s] %s\n", a.engine, a.desc)
+	}
+	fmt.Println("Applied.")
+	return nil
+}
+
+func planMySQL(plan *applyPlan, s *applyEngineSpec) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	plan.closers = append(plan.closers, func() { conn.Close() })
+
+	for _, u := range s.Users {
+		name := u.Name
+		exists, err := mysqlUserExists(conn, name, "%")
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		pw := genPassword()
+		plan.credentials = append(plan.credentials, applyCredential{credentialKey("mysql", name), pw})
+		plan.add("mysql", "create user "+name, func() error { return mysqlCreateUser(conn, name, "%", pw, mysqlAccountOptions{}) })
+	}
+	for _, d := range s.Databases {
+		name := d.Name
+		exists, err := mysqlDBExists(conn, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			plan.add("mysql", "create database "+name, func() error { return mysqlCreateDatabase(conn, name, mysqlDatabaseOptions{}) })
+		}
+	}
+	for _, g := range s.Grants {
+		user, database, preset := g.User, g.Database, g.Preset
+		if preset == "" {
+			preset = presetOwner
+		}
+		missing, err := mysqlMissingPrivileges(conn, database, user, preset)
+		if err != nil {
+			return err
+		}
+		if len(missing) > 0 {
+			plan.add("mysql", fmt.Sprintf("grant %s on %s to %s (missing %s)", preset, database, user, strings.Join(missing, ", ")),
+				func() error { return mysqlGrant(conn, database, user, "%", preset) })
+		}
+	}
+	if !applyPrune {
+		return nil
+	}
+	declaredDBs, declaredUsers := s.declaredDatabases(), s.declaredUsers()
+	dbs, err := queryStrings(conn, "SELECT schema_name FROM information_schema.schemata ORDER BY schema_name")
+	if err != nil {
+		return err
+	}
+	for _, name := range dbs {
+		if declaredDBs[name] || mysqlSystemDatabases[name] || isProtected(name) || !safeIdent.MatchString(name) {
+			continue
+		}
+		name := name
+		plan.addPrune("mysql", "drop database "+name, func() error {
+			if !dbNoBackup {
+				if err := backupToTrash("mysql", name, mysqlDumpFile, func(e *trash.Entry) error {
+					return dumpMySQLDatabase(cfg, name, e)
+				}); err != nil {
+					return err
+				}
+			}
+			return execSQL(conn, "DROP DATABASE `"+name+"`")
+		})
+	}
+	rows, err := conn.QueryContext(dbCtx, "SELECT user, host FROM mysql.user ORDER BY user, host")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, host string
+		if err := rows.Scan(&name, &host); err != nil {
+			return err
+		}
+		if declaredUsers[name] || mysqlSystemUsers[name] || name == cfg.User || isProtected(name) || name == "" ||
+			!safeIdent.MatchString(name) || !safeAccountHost.MatchString(host) {
+			continue
+		}
+		account := mysqlAccount(name, host)
+		plan.addPrune("mysql", "drop user "+name+"@"+host, func() error {
+			return execSQL(conn, "DROP USER "+account)
+		})
+	}
+	return rows.Err()
+}
+
+// mysqlMissingPrivileges lists the preset's privileges that username@'%' does not hold on database.
+func mysqlMissingPrivileges(conn *sql.DB, database, username, preset string) ([]string, error) {
+	want := mysqlDDLPrivs
+	if preset != presetOwner {
+		want = mysqlPresetPrivileges[preset]
+	}
+	held, err := queryStrings(conn, "SELECT privilege_type FROM information_schema.schema_privileges WHERE grantee = ? AND table_schema = ?",
+		"'"+username+"'@'%'", database)
+	if err != nil {
+		return nil, err
+	}
+	have := map[string]bool{}
+	for _, p := range held {
+		have[p] = true
+	}
+	var missing []string
+	for _, p := range strings.Split(want, ", ") {
+		if !have[p] {
+			missing = append(missing, p)
+		}
+	}
+	return missing, nil
+}
+
+// queryStrings returns the first column of every row.
+func queryStrings(conn sqlSession, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.QueryContext(dbCtx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		out = append(out, s)
+	}
+	return out, rows.Err()
+}
+
+func planPostgres(plan *applyPlan, s *applyEngineSpec) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	plan.closers = append(plan.closers, func() { conn.Close() })
+
+	declaredUsers := s.declaredUsers()
+	for _, u := range s.Users {
+		name := u.Name
+		exists, err := pgRoleExists(conn, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		pw := genPassword()
+		plan.credentials = append(plan.credentials, applyCredential{credentialKey("postgres", name), pw})
+		plan.add("postgres", "create user "+name, func() error { return pgCreateUser(conn, name, pw, pgRoleOptions{}) })
+	}
+	newDBs := map[string]bool{}
+	for _, d := range s.Databases {
+		name, owner := d.Name, d.Owner
+		if owner == "" {
+			owner = cfg.User
+		}
+		exists, err := pgDBExists(conn, name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if ok, err := pgRoleExists(conn, owner); err != nil {
+			return err
+		} else if !ok && !declaredUsers[owner] {
+			return fmt.Errorf("owner %s of database %s does not exist and is not declared", owner, name)
+		}
+		newDBs[name] = true
+		plan.add("postgres", "create database "+name+" owner "+owner, func() error { return pgCreateDatabase(conn, owner, name, pgDatabaseOptions{}) })
+	}
+
+	// Objects inside databases: new databases have none yet, existing ones are inspected.
+	dbConns := map[string]*sql.DB{}
+	inDB := func(database string) (*sql.DB, error) {
+		if c, ok := dbConns[database]; ok {
+			return c, nil
+		}
+		dcfg := cfg
+		dcfg.Database = database
+		c, err := openPg(dcfg)
+		if err != nil {
+			return nil, err
+		}
+		dbConns[database] = c
+		plan.closers = append(plan.closers, func() { c.Close() })
+		return c, nil
+	}
+	for _, sc := range s.Schemas {
+		database, name, owner := sc.Database, sc.Name, sc.Owner
+		if !newDBs[database] {
+			c, err := inDB(database)
+			if err != nil {
+				return err
+			}
+			var n int
+			if err := c.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM pg_namespace WHERE nspname = $1", name).Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		desc := "create schema " + database + "." + name
+		if owner != "" {
+			desc += " owner " + owner
+		}
+		plan.add("postgres", desc, func() error {
+			c, err := inDB(database)
+			if err != nil {
+				return err
+			}
+			q := `CREATE SCHEMA IF NOT EXISTS "` + name + `"`
+			if owner != "" {
+				q += ` AUTHORIZATION "` + owner + `"`
+			}
+			return execSQL(c, q)
+		})
+	}
+	for _, e := range s.Extensions {
+		database, name := e.Database, e.Name
+		if !newDBs[database] {
+			c, err := inDB(database)
+			if err != nil {
+				return err
+			}
+			var n int
+			if err := c.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM pg_extension WHERE extname = $1", name).Scan(&n); err != nil {
+				return err
+			}
+			if n > 0 {
+				continue
+			}
+		}
+		plan.add("postgres", "create extension "+name+" in "+database, func() error {
+			c, err := inDB(database)
+			if err != nil {
+				return err
+			}
+			return pgCreateExtension(c, name, "", "", false)
+		})
+	}
+	for _, g := range s.Grants {
+		user, database, preset := g.User, g.Database, g.Preset
+		if preset == "" {
+			preset = presetOwner
+		}
+		if !newDBs[database] {
+			if ok, err := pgRoleExists(conn, user); err != nil {
+				return err
+			} else if ok {
+				c, err := inDB(database)
+				if err != nil {
+					return err
+				}
+				held, err := pgHoldsPreset(c, database, user, preset)
+				if err != nil {
+					return err
+				}
+				if held {
+					continue
+				}
+			}
+		}
+		plan.add("postgres", fmt.Sprintf("grant %s on %s to %s", preset, database, user), func() error {
+			return pgGrant(database, user, preset)
+		})
+	}
+	if !applyPrune {
+		return nil
+	}
+	declaredDBs := s.declaredDatabases()
+	dbs, err := queryStrings(conn, "SELECT datname FROM pg_database WHERE datistemplate = false ORDER BY datname")
+	if err != nil {
+		return err
+	}
+	for _, name := range dbs {
+		if declaredDBs[name] || pgSystemDatabases[name] || isProtected(name) || !safeIdent.MatchString(name) {
+			continue
+		}
+		name := name
+		plan.addPrune("postgres", "drop database "+name, func() error {
+			if !dbNoBackup {
+				if err := backupToTrash("postgres", name, pgDumpFile, func(e *trash.Entry) error {
+					return dumpPgDatabase(cfg, name, e)
+				}); err != nil {
+					return err
+				}
+			}
+			return execSQL(conn, `DROP DATABASE "`+name+`"`)
+		})
+	}
+	users, err := queryStrings(conn, "SELECT rolname FROM pg_roles WHERE rolname NOT LIKE 'pg\\_%' AND NOT rolsuper ORDER BY rolname")
+	if err != nil {
+		return err
+	}
+	for _, name := range users {
+		if declaredUsers[name] || pgSystemUsers[name] || name == cfg.User || isProtected(name) || !safeIdent.MatchString(name) {
+			continue
+		}
+		name := name
+		plan.addPrune("postgres", "drop user "+name, func() error {
+			return execSQL(conn, `DROP USER "`+name+`"`)
+		})
+	}
+	return nil
+}
+
+// pgTablePrivileges expands a preset's table privileges for has_table_privilege checks.
+func pgTablePrivileges(preset string) []string {
+	switch pgPresets[preset].tables {
+	case "SELECT":
+		return []string{"SELECT"}
+	case "SELECT, INSERT, UPDATE, DELETE":
+		return []string{"SELECT", "INSERT", "UPDATE", "DELETE"}
+	default:
+		return []string{"SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"}
+	}
+}
+
+// pgHoldsPreset reports whether user already has the preset's database, public schema and table privileges.
+// c must be connected to database.
+func pgHoldsPreset(c *sql.DB, database, user, preset string) (bool, error) {
+	dbPrivs := []string{"CONNECT", "TEMPORARY", "CREATE"}
+	schemaPrivs := []string{"USAGE", "CREATE"}
+	if p := pgPresets[preset]; p.database != "ALL PRIVILEGES" {
+		dbPrivs = strings.Split(p.database, ", ")
+		schemaPrivs = strings.Split(p.schema, ", ")
+	}
+	var missing int
+	err := c.QueryRowContext(dbCtx, `SELECT
+		(SELECT COUNT(*) FROM unnest($3::text[]) p WHERE NOT has_database_privilege($1, $2, p)) +
+		(SELECT COUNT(*) FROM unnest($4::text[]) p WHERE NOT has_schema_privilege($1, 'public', p)) +
+		(SELECT COUNT(*) FROM pg_tables t, unnest($5::text[]) p WHERE t.schemaname = 'public'
+			AND NOT has_table_privilege($1, quote_ident(t.schemaname) || '.' || quote_ident(t.tablename), p))`,
+		user, database, pq.Array(dbPrivs), pq.Array(schemaPrivs), pq.Array(pgTablePrivileges(preset))).Scan(&missing)
+	return missing == 0, err
+}
+
+func planMongo(plan *applyPlan, s *applyEngineSpec) error {
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	plan.closers = append(plan.closers, func() { client.Disconnect(ctx) })
+	server := mongoDriver{client}
+
+	var info struct {
+		Users []struct {
+			User  string `bson:"user"`
+			Roles []struct {
+				Role string `bson:"role"`
+				DB   string `bson:"db"`
+			} `bson:"roles"`
+		} `bson:"users"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "usersInfo", Value: 1}}).Decode(&info); err != nil {
+		return err
+	}
+	existingUsers := map[string]map[string]bool{}
+	for _, u := range info.Users {
+		roles := map[string]bool{}
+		for _, r := range u.Roles {
+			roles[r.Role+"@"+r.DB] = true
+		}
+		existingUsers[u.User] = roles
+	}
+
+	for _, u := range s.Users {
+		name := u.Name
+		if _, ok := existingUsers[name]; ok {
+			continue
+		}
+		pw := genPassword()
+		plan.credentials = append(plan.credentials, applyCredential{credentialKey("mongo", name), pw})
+		plan.add("mongo", "create user "+name, func() error { return mongoCreateUser(ctx, server, name, pw, bson.A{}) })
+	}
+	for _, d := range s.Databases {
+		name := d.Name
+		exists, err := mongoDBExists(ctx, server, name)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			plan.add("mongo", "create database "+name, func() error { return mongoCreateDatabase(ctx, server, name) })
+		}
+	}
+	for _, g := range s.Grants {
+		args := []string{g.User, g.Database}
+		if g.Role != "" {
+			args = []string{g.User, g.Role, g.Database}
+		}
+		preset := g.Preset
+		if preset == "" && g.Role == "" {
+			preset = presetOwner
+		}
+		user, roles, database, err := mongoRoleArgs(args, preset)
+		if err != nil {
+			return err
+		}
+		var missing bson.A
+		var names []string
+		for _, r := range roles {
+			rd := r.(bson.D)
+			role, _ := docValue(rd, "role")
+			if !existingUsers[user][fmt.Sprint(role)+"@"+database] {
+				missing = append(missing, r)
+				names = append(names, fmt.Sprint(role))
+			}
+		}
+		if len(missing) > 0 {
+			plan.add("mongo", fmt.Sprintf("grant %s on %s to %s", strings.Join(names, ", "), database, user),
+				func() error { return mongoGrantRoles(ctx, server, user, missing) })
+		}
+	}
+	if !applyPrune {
+		return nil
+	}
+	declaredDBs, declaredUsers := s.declaredDatabases(), s.declaredUsers()
+	list, err := client.ListDatabases(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, d := range list.Databases {
+		if declaredDBs[d.Name] || mongoSystemDatabases[d.Name] || isProtected(d.Name) {
+			continue
+		}
+		name := d.Name
+		plan.addPrune("mongo", "drop database "+name, func() error {
+			if !dbNoBackup {
+				if err := backupToTrash("mongo", name, mongoDumpFile, func(e *trash.Entry) error {
+					return dumpMongoDatabase(ctx, client, name, e)
+				}); err != nil {
+					return err
+				}
+			}
+			return runMongoCommand(ctx, server, name, bson.D{{Key: "dropDatabase", Value: 1}})
+		})
+	}
+	for _, u := range info.Users {
+		if declaredUsers[u.User] || mongoSystemUsers[u.User] || u.User == cfg.User || isProtected(u.User) {
+			continue
+		}
+		name := u.User
+		plan.addPrune("mongo", "drop user "+name, func() error {
+			return runMongoCommand(ctx, server, "admin", bson.D{{Key: "dropUser", Value: name}})
+		})
+	}
+	return nil
+}
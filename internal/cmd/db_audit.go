@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/audit"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	auditEngine, auditCommand, auditUser, auditServer string
+	auditSince                                        string
+	auditFailed, auditJSON                            bool
+	auditLimit                                        int
+)
+
+var dbAuditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Show the local audit log of mutating db commands",
+	Long:  "Every create/delete/grant/revoke/rotate/kill/apply run through `as db` is appended to $XDG_STATE_HOME/awesome-shell/audit.jsonl (default ~/.local/state/awesome-shell).",
+	Args:  cobra.NoArgs,
+	RunE:  runDBAudit,
+}
+
+// auditedCommands are the db subcommands that change server state and are written to the audit log.
+var auditedCommands = map[*cobra.Command]bool{
+	mysqlCreateDBCmd: true, mysqlCreateUserCmd: true, mysqlDeleteDBCmd: true, mysqlDeleteUserCmd: true,
+	mysqlGrantCmd: true, mysqlRevokeCmd: true, mysqlRotatePasswordCmd: true,
+	mysqlLockUserCmd: true, mysqlUnlockUserCmd: true, mysqlKillCmd: true,
+	mysqlBootstrapCmd: true, mysqlCloneCmd: true,
+
+	pgsqlCreateDBCmd: true, pgsqlCreateUserCmd: true, pgsqlDeleteDBCmd: true, pgsqlDeleteUserCmd: true,
+	pgsqlGrantCmd: true, pgsqlRevokeCmd: true, pgsqlRotatePasswordCmd: true, pgsqlKillCmd: true,
+	pgsqlCreateRoleCmd: true, pgsqlRoleGrantCmd: true, pgsqlRoleRevokeCmd: true,
+	pgsqlCreateSchemaCmd: true, pgsqlDropSchemaCmd: true, pgsqlGrantSchemaCmd: true,
+	pgsqlExtInstallCmd: true, pgsqlExtRemoveCmd: true, pgsqlExtUpdateCmd: true,
+	pgsqlBootstrapCmd: true, pgsqlCloneCmd: true,
+
+	mongoCreateDBCmd: true, mongoCreateUserCmd: true, mongoDeleteDBCmd: true, mongoDeleteUserCmd: true,
+	mongoGrantCmd: true, mongoRevokeCmd: true, mongoRotatePasswordCmd: true,
+	mongoIndexesCreateCmd: true, mongoIndexesDropCmd: true, mongoIndexesSyncCmd: true,
+	mongoBootstrapCmd: true, mongoCloneCmd: true,
+
+	dbApplyCmd: true, dbTrashRestoreCmd: true, dbTrashPurgeCmd: true,
+}
+
+// auditResult is set by an audited command that returns without changing anything.
+var auditResult string
+
+// cancelled reports a declined confirmation; the run is logged as cancelled.
+func cancelled() error {
+	fmt.Println("Cancelled.")
+	auditResult = audit.ResultCancelled
+	return nil
+}
+
+// noop prints msg for a run that found nothing to change; it is logged as noop.
+func noop(msg string) error {
+	fmt.Println(msg)
+	auditResult = audit.ResultNoop
+	return nil
+}
+
+func init() {
+	f := dbAuditCmd.Flags()
+	f.StringVar(&auditEngine, "engine", "", "only this engine (mysql, postgres, mongo)")
+	f.StringVar(&auditCommand, "command", "", "only commands containing this text (e.g. delete-db)")
+	f.StringVar(&auditUser, "os-user", "", "only entries by this OS user")
+	f.StringVar(&auditServer, "server", "", "only entries against this server (host:port)")
+	f.StringVar(&auditSince, "since", "", "only entries newer than a duration (e.g. 24h) or date (YYYY-MM-DD)")
+	f.BoolVar(&auditFailed, "failed", false, "only failed operations")
+	f.IntVar(&auditLimit, "limit", 50, "show the most recent N entries (0 = all)")
+	f.BoolVar(&auditJSON, "json", false, "print entries as JSON lines")
+	dbCmd.AddCommand(dbAuditCmd)
+}
+
+// enableAudit wraps the RunE of every audited command under root so its outcome is logged.
+func enableAudit(root *cobra.Command) {
+	for _, c := range root.Commands() {
+		enableAudit(c)
+	}
+	if root.RunE == nil || !auditedCommands[root] {
+		return
+	}
+	run := root.RunE
+	root.RunE = func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+		auditResult = ""
+		err := run(cmd, args)
+		e := audit.NewEntry(strings.TrimPrefix(cmd.CommandPath(), rootCmd.Name()+" "))
+		e.Engine = commandEngine(cmd)
+		e.Server = engineServer(e.Engine)
+		e.Args = auditArgs(cmd, args)
+		e.Duration = time.Since(start).Seconds()
+		e.DryRun = exec.DryRun
+		e.Result = audit.ResultOK
+		if auditResult != "" {
+			e.Result = auditResult
+		}
+		if err != nil {
+			e.Result, e.Error = audit.ResultError, err.Error()
+		}
+		if werr := audit.Append(e); werr != nil {
+			fmt.Fprintln(os.Stderr, "warning: audit log:", werr)
+		}
+		return err
+	}
+}
+
+// commandEngine returns the engine of the nearest mysql/pgsql/mongo ancestor, or "" for engine-neutral commands.
+func commandEngine(cmd *cobra.Command) string {
+	for c := cmd; c != nil; c = c.Parent() {
+		switch c {
+		case mysqlCmd:
+			return "mysql"
+		case pgsqlCmd:
+			return "postgres"
+		case mongoCmd:
+			return "mongo"
+		}
+	}
+	return ""
+}
+
+func engineServer(engine string) string {
+	if dbViaCompose != "" {
+		return "compose:" + dbViaCompose
+	}
+	switch engine {
+	case "mysql":
+		cfg := getMySQLConfig()
+		return cfg.Host + ":" + cfg.Port
+	case "postgres":
+		cfg := getPgConfig()
+		return cfg.Host + ":" + cfg.Port
+	case "mongo":
+		cfg := getMongoConfig()
+		return cfg.Host + ":" + cfg.Port
+	}
+	return ""
+}
+
+// auditArgs returns the positional arguments followed by every flag set on the command line, with secrets redacted.
+func auditArgs(cmd *cobra.Command, args []string) []string {
+	out := append([]string(nil), args...)
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		v := f.Value.String()
+		if audit.IsSecret(f.Name) {
+			v = audit.Redacted
+		}
+		out = append(out, "--"+f.Name+"="+v)
+	})
+	return out
+}
+
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q (use a duration like 24h or a date YYYY-MM-DD)", s)
+}
+
+func runDBAudit(cmd *cobra.Command, args []string) error {
+	var since time.Time
+	if auditSince != "" {
+		var err error
+		if since, err = parseSince(auditSince); err != nil {
+			return err
+		}
+	}
+	entries, err := audit.Read(func(e audit.Entry) bool {
+		switch {
+		case auditEngine != "" && e.Engine != auditEngine,
+			auditCommand != "" && !strings.Contains(e.Command, auditCommand),
+			auditUser != "" && e.User != auditUser,
+			auditServer != "" && e.Server != auditServer,
+			auditFailed && e.Result != audit.ResultError,
+			!since.IsZero() && e.Time.Before(since):
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	if auditLimit > 0 && len(entries) > auditLimit {
+		entries = entries[len(entries)-auditLimit:]
+	}
+	if auditJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(entries) == 0 {
+		fmt.Println("No audit entries in", audit.Path())
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tUSER\tHOST\tSERVER\tCOMMAND\tARGS\tRESULT")
+	for _, e := range entries {
+		result := e.Result
+		if e.DryRun {
+			result += " (dry-run)"
+		}
+		if e.Error != "" {
+			result += ": " + oneLine(e.Error, 60)
+		}
+		server := e.Server
+		if server == "" {
+			server = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Time.Local().Format("2006-01-02 15:04:05"), e.User, e.Host,
+			server, e.Command, strings.Join(e.Args, " "), result)
+	}
+	return w.Flush()
+}
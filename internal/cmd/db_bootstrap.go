@@ -0,0 +1,273 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	mysqlBootstrapCmd = &cobra.Command{
+		Use:   "bootstrap [name]",
+		Short: "Create database and same-named user with owner access, then print connection strings",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlBootstrap,
+	}
+	pgsqlBootstrapCmd = &cobra.Command{
+		Use:   "bootstrap [name]",
+		Short: "Create database and same-named owner role, then print connection strings",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlBootstrap,
+	}
+	mongoBootstrapCmd = &cobra.Command{
+		Use:   "bootstrap [name]",
+		Short: "Create database and same-named user with dbOwner, then print connection strings",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMongoBootstrap,
+	}
+)
+
+func init() {
+	mysqlCmd.AddCommand(mysqlBootstrapCmd)
+	pgsqlCmd.AddCommand(pgsqlBootstrapCmd)
+	mongoCmd.AddCommand(mongoBootstrapCmd)
+}
+
+// passwordPlaceholder stands in for the password of a user that already existed.
+const passwordPlaceholder = "<password>"
+
+// appConnection describes how an application reaches its bootstrapped database.
+type appConnection struct {
+	scheme, host, port, database, user, password string
+	query                                        string // extra URL query, e.g. authSource=admin
+}
+
+func (c appConnection) url(scheme string) string {
+	u := url.URL{
+		Scheme:   scheme,
+		User:     url.UserPassword(c.user, c.password),
+		Host:     c.host + ":" + c.port,
+		Path:     "/" + c.database,
+		RawQuery: c.query,
+	}
+	s := u.String()
+	if c.password == passwordPlaceholder {
+		s = replaceEscapedPlaceholder(s)
+	}
+	return s
+}
+
+// replaceEscapedPlaceholder undoes URL escaping of the placeholder so it is easy to spot and replace.
+func replaceEscapedPlaceholder(s string) string {
+	return strings.ReplaceAll(s, url.QueryEscape(passwordPlaceholder), passwordPlaceholder)
+}
+
+func (c appConnection) jdbc() string {
+	q := url.Values{}
+	q.Set("user", c.user)
+	q.Set("password", c.password)
+	s := "jdbc:" + c.scheme + "://" + c.host + ":" + c.port + "/" + c.database + "?" + q.Encode()
+	if c.query != "" {
+		s += "&" + c.query
+	}
+	if c.password == passwordPlaceholder {
+		s = replaceEscapedPlaceholder(s)
+	}
+	return s
+}
+
+// printAppConnection prints URL, .env lines, JDBC and SQLAlchemy/Prisma forms of c.
+func printAppConnection(c appConnection, sqlalchemyScheme string) {
+	if c.password == passwordPlaceholder {
+		fmt.Println("User existed before, password unchanged: replace", passwordPlaceholder, "below (or run rotate-password).")
+	} else {
+		fmt.Println("Password:", c.password)
+		fmt.Println("Save this password.")
+	}
+	fmt.Println()
+	fmt.Println("URL:")
+	fmt.Println("  " + c.url(c.scheme))
+	fmt.Println()
+	fmt.Println(".env:")
+	fmt.Println("  DB_HOST=" + c.host)
+	fmt.Println("  DB_PORT=" + c.port)
+	fmt.Println("  DB_NAME=" + c.database)
+	fmt.Println("  DB_USER=" + c.user)
+	fmt.Println("  DB_PASSWORD=" + c.password)
+	fmt.Println("  DATABASE_URL=" + c.url(c.scheme))
+	fmt.Println()
+	fmt.Println("JDBC:")
+	fmt.Println("  " + c.jdbc())
+	fmt.Println()
+	if sqlalchemyScheme != "" {
+		fmt.Println("SQLAlchemy:")
+		fmt.Println("  " + c.url(sqlalchemyScheme))
+		fmt.Println()
+	}
+	prisma := c
+	if c.scheme == "postgresql" {
+		prisma.query = "schema=public"
+	}
+	fmt.Println("Prisma:")
+	fmt.Println("  " + prisma.url(c.scheme))
+}
+
+func runMysqlBootstrap(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
+	name := args[0]
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := mysqlDBExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Database '" + name + "' already exists.")
+	} else {
+		if err := mysqlCreateDatabase(conn, name, mysqlDatabaseOptions{}); err != nil {
+			return err
+		}
+		fmt.Println("Database '" + name + "' created.")
+	}
+
+	pw := passwordPlaceholder
+	exists, err = mysqlUserExists(conn, name, mysqlAccountHost)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("User '" + name + "' already exists.")
+	} else {
+		pw = genPassword()
+		if err := mysqlCreateUser(conn, name, mysqlAccountHost, pw, mysqlAccountOptions{}); err != nil {
+			return err
+		}
+		fmt.Println("User '" + name + "' created.")
+	}
+
+	if err := mysqlGrant(conn, name, name, mysqlAccountHost, presetOwner); err != nil {
+		return err
+	}
+	fmt.Println("Granted owner on '" + name + "' to '" + name + "'.")
+	fmt.Println()
+	printAppConnection(appConnection{scheme: "mysql", host: cfg.Host, port: cfg.Port, database: name, user: name, password: pw}, "mysql+pymysql")
+	return nil
+}
+
+func runPgsqlBootstrap(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	name := args[0]
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// The role comes first so it can own the new database.
+	pw := passwordPlaceholder
+	exists, err := pgRoleExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("User '" + name + "' already exists.")
+	} else {
+		pw = genPassword()
+		if err := pgCreateUser(conn, name, pw, pgRoleOptions{}); err != nil {
+			return err
+		}
+		fmt.Println("User '" + name + "' created.")
+	}
+
+	exists, err = pgDBExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Database '" + name + "' already exists.")
+	} else {
+		if err := pgCreateDatabase(conn, name, name, pgDatabaseOptions{}); err != nil {
+			return err
+		}
+		fmt.Println("Database '" + name + "' created.")
+	}
+
+	if err := pgGrant(name, name, presetOwner); err != nil {
+		return err
+	}
+	fmt.Println("Granted owner on '" + name + "' to '" + name + "'.")
+	fmt.Println()
+	printAppConnection(appConnection{scheme: "postgresql", host: cfg.Host, port: cfg.Port, database: name, user: name, password: pw}, "postgresql+psycopg2")
+	return nil
+}
+
+func runMongoBootstrap(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	name := args[0]
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	server := mongoDriver{client}
+
+	exists, err := mongoDBExists(ctx, server, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Database '" + name + "' already exists.")
+	} else {
+		if err := mongoCreateDatabase(ctx, server, name); err != nil {
+			return err
+		}
+		fmt.Println("Database '" + name + "' created.")
+	}
+
+	roles := bson.A{}
+	for _, r := range mongoPresetRoles[presetOwner] {
+		roles = append(roles, bson.D{{Key: "role", Value: r}, {Key: "db", Value: name}})
+	}
+	pw := passwordPlaceholder
+	exists, err = mongoUserExists(ctx, server, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("User '" + name + "' already exists.")
+		if err := mongoGrantRoles(ctx, server, name, roles); err != nil {
+			return err
+		}
+	} else {
+		pw = genPassword()
+		if err := mongoCreateUser(ctx, server, name, pw, roles); err != nil {
+			return err
+		}
+		fmt.Println("User '" + name + "' created.")
+	}
+	fmt.Println("Granted owner on '" + name + "' to '" + name + "'.")
+	fmt.Println()
+	// Users live in admin, so clients must authenticate against it.
+	printAppConnection(appConnection{scheme: "mongodb", host: cfg.Host, port: cfg.Port, database: name, user: name, password: pw, query: "authSource=admin"}, "")
+	return nil
+}
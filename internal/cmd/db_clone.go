@@ -0,0 +1,580 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	mysqlCloneCmd = &cobra.Command{
+		Use:   "clone [source] [target]",
+		Short: "Copy a database on the same server (tables, views, triggers, routines and rows)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runMysqlClone,
+	}
+	pgsqlCloneCmd = &cobra.Command{
+		Use:   "clone [source] [target]",
+		Short: "Copy a database with CREATE DATABASE ... TEMPLATE (disconnects other sessions on the source)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlClone,
+	}
+	mongoCloneCmd = &cobra.Command{
+		Use:   "clone [source] [target]",
+		Short: "Copy a database on the same server (collections, views and indexes)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runMongoClone,
+	}
+)
+
+func init() {
+	mysqlCmd.AddCommand(mysqlCloneCmd)
+	pgsqlCmd.AddCommand(pgsqlCloneCmd)
+	mongoCmd.AddCommand(mongoCloneCmd)
+}
+
+// cloneNames validates source and target and refuses to clone a database onto itself.
+func cloneNames(args []string) (string, string, error) {
+	for _, n := range args {
+		if err := requireSafeIdent(n, "database"); err != nil {
+			return "", "", err
+		}
+	}
+	if args[0] == args[1] {
+		return "", "", fmt.Errorf("source and target are the same database")
+	}
+	return args[0], args[1], nil
+}
+
+// rowCount is the number of rows of one table or collection in the source and the clone.
+type rowCount struct {
+	name           string
+	source, target int64
+}
+
+// printRowCounts prints the comparison and fails when any count differs.
+func printRowCounts(counts []rowCount, unit string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.ToUpper(unit)+"\tSOURCE\tTARGET\t")
+	var diff int
+	for _, c := range counts {
+		mark := ""
+		if c.source != c.target {
+			mark = "differs"
+			diff++
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\n", c.name, c.source, c.target, mark)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if diff > 0 {
+		return fmt.Errorf("row counts differ for %d %s(s); was the source written to during the clone?", diff, unit)
+	}
+	return nil
+}
+
+func runMysqlClone(cmd *cobra.Command, args []string) error {
+	if err := refuseViaCompose(cmd.CommandPath()); err != nil {
+		return err
+	}
+	src, dst, err := cloneNames(args)
+	if err != nil {
+		return err
+	}
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if ok, err := mysqlDBExists(conn, src); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("database '%s' does not exist", src)
+	}
+	if ok, err := mysqlDBExists(conn, dst); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("database '%s' already exists", dst)
+	}
+	var opts mysqlDatabaseOptions
+	if err := conn.QueryRowContext(dbCtx, "SELECT default_character_set_name, default_collation_name FROM information_schema.schemata WHERE schema_name = ?",
+		src).Scan(&opts.charset, &opts.collation); err != nil {
+		return err
+	}
+	tables, err := queryStrings(conn, "SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'BASE TABLE' ORDER BY table_name", src)
+	if err != nil {
+		return err
+	}
+	views, err := queryStrings(conn, "SELECT table_name FROM information_schema.tables WHERE table_schema = ? AND table_type = 'VIEW' ORDER BY table_name", src)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cloning '%s' to '%s' (%d tables, %d views)\n", src, dst, len(tables), len(views))
+	if err := mysqlCreateDatabase(conn, dst, opts); err != nil {
+		return err
+	}
+	if err := copyMySQLClone(conn, src, dst, tables, views); err != nil {
+		if exec.DryRun {
+			return err
+		}
+		// The target did not exist before, so nothing but the incomplete copy is lost.
+		if _, derr := conn.ExecContext(context.Background(), "DROP DATABASE `"+dst+"`"); derr != nil {
+			return fmt.Errorf("%w (the incomplete clone '%s' is left behind: %v)", err, dst, derr)
+		}
+		return fmt.Errorf("%w (the incomplete clone '%s' was dropped)", err, dst)
+	}
+	if exec.DryRun {
+		return nil
+	}
+
+	var counts []rowCount
+	for _, t := range tables {
+		c := rowCount{name: t}
+		if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM `"+src+"`.`"+t+"`").Scan(&c.source); err != nil {
+			return err
+		}
+		if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM `"+dst+"`.`"+t+"`").Scan(&c.target); err != nil {
+			return err
+		}
+		counts = append(counts, c)
+	}
+	if err := printRowCounts(counts, "table"); err != nil {
+		return err
+	}
+	fmt.Println("Database '" + src + "' cloned to '" + dst + "'.")
+	return nil
+}
+
+// copyMySQLClone copies the tables, rows, views, triggers and routines of src into the empty database dst.
+// Every statement runs on one connection, so USE, FOREIGN_KEY_CHECKS and the SQL mode hold for all of them;
+// a lost connection fails the copy instead of carrying on in a fresh session without them.
+func copyMySQLClone(pool *sql.DB, src, dst string, tables, views []string) error {
+	ctx := dbCtx
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var sqlMode string
+	if err := conn.QueryRowContext(ctx, "SELECT @@SESSION.sql_mode").Scan(&sqlMode); err != nil {
+		return err
+	}
+	// Rows are copied as they are: an id of 0 must not be renumbered by AUTO_INCREMENT.
+	copyMode := "NO_AUTO_VALUE_ON_ZERO"
+	if sqlMode != "" {
+		copyMode = sqlMode + "," + copyMode
+	}
+	for _, q := range []string{"USE `" + dst + "`", "SET FOREIGN_KEY_CHECKS = 0", "SET SESSION sql_mode = '" + copyMode + "'"} {
+		if err := execSQL(conn, q); err != nil {
+			return err
+		}
+	}
+	defer execSQL(conn, "SET FOREIGN_KEY_CHECKS = 1")
+	for i, t := range tables {
+		fmt.Printf("  [%d/%d] %s\n", i+1, len(tables), t)
+		ddl, err := mysqlShowCreate(ctx, conn, "SHOW CREATE TABLE `"+src+"`.`"+t+"`", 1)
+		if err != nil {
+			return err
+		}
+		if err := execSQL(conn, ddl); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+		cols, err := queryStrings(conn, `SELECT column_name FROM information_schema.columns
+WHERE table_schema = ? AND table_name = ? AND extra NOT LIKE '%VIRTUAL GENERATED%' AND extra NOT LIKE '%STORED GENERATED%'
+ORDER BY ordinal_position`, src, t)
+		if err != nil {
+			return err
+		}
+		list := "`" + strings.Join(cols, "`, `") + "`"
+		if err := execSQL(conn, "INSERT INTO `"+dst+"`.`"+t+"` ("+list+") SELECT "+list+" FROM `"+src+"`.`"+t+"`"); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+	}
+
+	// Views, triggers and routines are created in the session's own SQL mode, which they keep.
+	if err := execSQL(conn, "SET SESSION sql_mode = '"+sqlMode+"'"); err != nil {
+		return err
+	}
+	if err := cloneMySQLViews(conn, src, dst, views); err != nil {
+		return err
+	}
+
+	// Triggers and routines are re-created after the rows so triggers do not fire on the copy.
+	type object struct{ kind, name string }
+	var objects []object
+	rows, err := conn.QueryContext(ctx, `SELECT 'TRIGGER', trigger_name FROM information_schema.triggers WHERE trigger_schema = ?
+UNION ALL SELECT routine_type, routine_name FROM information_schema.routines WHERE routine_schema = ?`, src, src)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, o := range objects {
+		fmt.Printf("  %s %s\n", strings.ToLower(o.kind), o.name)
+		ddl, err := mysqlCloneDDL(conn, src, dst, o.kind, o.name)
+		if err != nil {
+			return err
+		}
+		if ddl == "" {
+			continue
+		}
+		if err := execSQL(conn, ddl); err != nil {
+			return fmt.Errorf("%s %s: %w", strings.ToLower(o.kind), o.name, err)
+		}
+	}
+	return nil
+}
+
+// mysqlCloneDDL returns the statement that re-creates object name of src inside dst, or "" (with a warning)
+// when the account may not read it.
+func mysqlCloneDDL(conn *sql.Conn, src, dst, kind, name string) (string, error) {
+	col := 2
+	if kind == "VIEW" {
+		col = 1
+	}
+	ddl, err := mysqlShowCreate(dbCtx, conn, "SHOW CREATE "+kind+" `"+src+"`.`"+name+"`", col)
+	if err != nil {
+		return "", err
+	}
+	if ddl == "" {
+		fmt.Fprintf(os.Stderr, "warning: no privilege to read %s %s, not cloned\n", strings.ToLower(kind), name)
+		return "", nil
+	}
+	// View definitions name the source schema explicitly.
+	return strings.ReplaceAll(mysqlDefiner.ReplaceAllString(ddl, ""), "`"+src+"`.", "`"+dst+"`."), nil
+}
+
+// cloneMySQLViews creates views in dependency order: a view that fails because another view it reads
+// does not exist yet is retried once the others are in place.
+func cloneMySQLViews(conn *sql.Conn, src, dst string, views []string) error {
+	pending := views
+	for len(pending) > 0 {
+		var retry []string
+		var lastErr error
+		for _, v := range pending {
+			ddl, err := mysqlCloneDDL(conn, src, dst, "VIEW", v)
+			if err != nil {
+				return err
+			}
+			if ddl == "" {
+				continue
+			}
+			err = execSQL(conn, ddl)
+			var me *mysql.MySQLError
+			if errors.As(err, &me) && me.Number == 1146 { // ER_NO_SUCH_TABLE
+				retry, lastErr = append(retry, v), fmt.Errorf("view %s: %w", v, err)
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("view %s: %w", v, err)
+			}
+			fmt.Printf("  view %s\n", v)
+		}
+		if len(retry) == len(pending) {
+			return lastErr
+		}
+		pending = retry
+	}
+	return nil
+}
+
+func runPgsqlClone(cmd *cobra.Command, args []string) error {
+	src, dst, err := cloneNames(args)
+	if err != nil {
+		return err
+	}
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var owner string
+	err = conn.QueryRowContext(dbCtx, "SELECT pg_get_userbyid(datdba) FROM pg_database WHERE datname = $1", src).Scan(&owner)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("database '%s' does not exist", src)
+	}
+	if err != nil {
+		return err
+	}
+	if ok, err := pgDBExists(conn, dst); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("database '%s' already exists", dst)
+	}
+
+	// A template database must have no other sessions while it is copied.
+	rows, err := conn.QueryContext(dbCtx, `SELECT pid, COALESCE(usename, ''), COALESCE(application_name, ''), COALESCE(client_addr::text, 'local')
+FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid() ORDER BY pid`, src)
+	if err != nil {
+		return err
+	}
+	var pids []int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for rows.Next() {
+		var pid int64
+		var user, app, addr string
+		if err := rows.Scan(&pid, &user, &app, &addr); err != nil {
+			rows.Close()
+			return err
+		}
+		if len(pids) == 0 {
+			fmt.Println("These sessions on '" + src + "' will be terminated:")
+			fmt.Fprintln(w, "  PID\tUSER\tAPPLICATION\tCLIENT")
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%s\t%s\n", pid, user, app, addr)
+		pids = append(pids, pid)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	w.Flush()
+	if len(pids) > 0 {
+		if !confirm("Type source database name to confirm: ", src) {
+			return cancelled()
+		}
+		if exec.DryRun {
+			fmt.Printf("[dry-run] SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = '%s' AND pid <> pg_backend_pid();\n", src)
+		} else if _, err := conn.ExecContext(dbCtx, "SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = $1 AND pid <> pg_backend_pid()", src); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Cloning '%s' to '%s'...\n", src, dst)
+	if err := execSQL(conn, `CREATE DATABASE "`+dst+`" WITH TEMPLATE "`+src+`" OWNER "`+owner+`"`); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "55006" {
+			return fmt.Errorf("%w (a client reconnected to '%s'; stop it and retry)", err, src)
+		}
+		return err
+	}
+	if exec.DryRun {
+		return nil
+	}
+
+	counts, err := pgTableCounts(src)
+	if err != nil {
+		return err
+	}
+	target, err := pgTableCounts(dst)
+	if err != nil {
+		return err
+	}
+	byName := map[string]int64{}
+	for _, c := range target {
+		byName[c.name] = c.source
+	}
+	for i := range counts {
+		counts[i].target = byName[counts[i].name]
+	}
+	if err := printRowCounts(counts, "table"); err != nil {
+		return err
+	}
+	fmt.Println("Database '" + src + "' cloned to '" + dst + "'.")
+	return nil
+}
+
+// pgTableCounts returns the exact row count of every user table in database, by schema-qualified name.
+func pgTableCounts(database string) ([]rowCount, error) {
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(dbCtx, `SELECT schemaname, tablename FROM pg_tables
+WHERE schemaname NOT IN ('pg_catalog', 'information_schema') ORDER BY schemaname, tablename`)
+	if err != nil {
+		return nil, err
+	}
+	var counts []rowCount
+	for rows.Next() {
+		var schema, table string
+		if err := rows.Scan(&schema, &table); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		counts = append(counts, rowCount{name: schema + "." + table})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, c := range counts {
+		schema, table, _ := strings.Cut(c.name, ".")
+		if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM "+pq.QuoteIdentifier(schema)+"."+pq.QuoteIdentifier(table)).Scan(&counts[i].source); err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
+
+func runMongoClone(cmd *cobra.Command, args []string) error {
+	if err := refuseViaCompose(cmd.CommandPath()); err != nil {
+		return err
+	}
+	src, dst, err := cloneNames(args)
+	if err != nil {
+		return err
+	}
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	server := mongoDriver{client}
+
+	if ok, err := mongoDBExists(ctx, server, src); err != nil {
+		return err
+	} else if !ok {
+		return fmt.Errorf("database '%s' does not exist", src)
+	}
+	if ok, err := mongoDBExists(ctx, server, dst); err != nil {
+		return err
+	} else if ok {
+		return fmt.Errorf("database '%s' already exists", dst)
+	}
+	from, to := client.Database(src), client.Database(dst)
+	specs, err := listMongoCollections(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Cloning '%s' to '%s' (%d collections and views)\n", src, dst, len(specs))
+	counts, err := copyMongoClone(ctx, server, from, to, specs)
+	if err != nil {
+		if exec.DryRun {
+			return err
+		}
+		// The target did not exist before, so nothing but the incomplete copy is lost.
+		if derr := to.Drop(context.Background()); derr != nil {
+			return fmt.Errorf("%w (the incomplete clone '%s' is left behind: %v)", err, dst, derr)
+		}
+		return fmt.Errorf("%w (the incomplete clone '%s' was dropped)", err, dst)
+	}
+	if exec.DryRun {
+		return nil
+	}
+
+	for i, c := range counts {
+		if counts[i].source, err = from.Collection(c.name).CountDocuments(ctx, bson.D{}); err != nil {
+			return err
+		}
+		if counts[i].target, err = to.Collection(c.name).CountDocuments(ctx, bson.D{}); err != nil {
+			return err
+		}
+	}
+	if err := printRowCounts(counts, "collection"); err != nil {
+		return err
+	}
+	fmt.Println("Database '" + src + "' cloned to '" + dst + "'.")
+	return nil
+}
+
+// copyMongoClone creates the collections of specs in the empty database to with the documents and indexes
+// of from, then the views, and returns the collections copied.
+func copyMongoClone(ctx context.Context, server mongoServer, from, to *mongo.Database, specs []mongoCollectionSpec) ([]rowCount, error) {
+	var counts []rowCount
+	var views []mongoCollectionSpec
+	for i, s := range specs {
+		if s.Type == "view" {
+			views = append(views, s)
+			continue
+		}
+		fmt.Printf("  [%d/%d] %s", i+1, len(specs), s.Name)
+		if err := runMongoCommand(ctx, server, to.Name(), append(bson.D{{Key: "create", Value: s.Name}}, s.Options...)); err != nil {
+			fmt.Println()
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		n, err := copyMongoDocuments(ctx, from.Collection(s.Name), to.Collection(s.Name))
+		fmt.Printf(": %d documents\n", n)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		indexes, err := listMongoIndexes(ctx, from.Collection(s.Name))
+		if err != nil {
+			return nil, err
+		}
+		for _, idx := range indexes {
+			if name, _ := docValue(idx, "name"); name == "_id_" {
+				continue
+			}
+			if err := createMongoIndex(ctx, to.Collection(s.Name), portableIndexSpec(idx)); err != nil {
+				return nil, fmt.Errorf("%s: %w", s.Name, err)
+			}
+		}
+		counts = append(counts, rowCount{name: s.Name})
+	}
+	for _, v := range views {
+		fmt.Println("  view", v.Name)
+		if err := runMongoCommand(ctx, server, to.Name(), append(bson.D{{Key: "create", Value: v.Name}}, v.Options...)); err != nil {
+			return nil, fmt.Errorf("%s: %w", v.Name, err)
+		}
+	}
+	return counts, nil
+}
+
+// copyMongoDocuments inserts every document of from into to in batches and returns how many were copied.
+func copyMongoDocuments(ctx context.Context, from, to *mongo.Collection) (int64, error) {
+	if exec.DryRun {
+		fmt.Print(" [dry-run] copy documents")
+		return 0, nil
+	}
+	cursor, err := from.Find(ctx, bson.D{})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+	var n int64
+	var batch []interface{}
+	insert := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := to.InsertMany(ctx, batch, options.InsertMany().SetBypassDocumentValidation(true))
+		n += int64(len(batch))
+		batch = nil
+		return err
+	}
+	for cursor.Next(ctx) {
+		batch = append(batch, append(bson.Raw(nil), cursor.Current...))
+		if len(batch) >= mongoInsertBatch {
+			if err := insert(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return n, err
+	}
+	return n, insert()
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/compose"
+	"github.com/spf13/cobra"
+)
+
+var dbComposeService string
+
+// composeCache holds the compose service settings per engine, so the compose file is read and reported on once per run.
+var composeCache = map[string]composeSettings{}
+
+func init() {
+	dbCmd.PersistentFlags().StringVar(&dbComposeService, "service", "", "compose service to take connection settings from when the compose file has several for the engine")
+}
+
+// composeSettings are the connection settings read from a compose service; empty fields are unknown.
+type composeSettings struct {
+	Service, Host, Port, User, Password string
+}
+
+// composeEngines describes, per engine, the container port and the environment holding the root credentials.
+var composeEngines = map[string]struct {
+	port, defaultUser  string
+	userVars, passVars []string
+}{
+	"mysql":    {port: "3306", defaultUser: "root", passVars: []string{"MYSQL_ROOT_PASSWORD", "MARIADB_ROOT_PASSWORD"}},
+	"postgres": {port: "5432", defaultUser: "postgres", userVars: []string{"POSTGRES_USER"}, passVars: []string{"POSTGRES_PASSWORD"}},
+	"mongo":    {port: "27017", defaultUser: "root", userVars: []string{"MONGO_INITDB_ROOT_USERNAME"}, passVars: []string{"MONGO_INITDB_ROOT_PASSWORD"}},
+}
+
+// findComposeService picks the engine's service from the nearest compose file: the --service one,
+// or the only one of that engine. It returns ok=false without a compose file or a matching service.
+func findComposeService(engine string) (compose.Service, string, bool, error) {
+	p := compose.Find()
+	if p == "" {
+		return compose.Service{}, "", false, nil
+	}
+	f, err := compose.Load(p)
+	if err != nil {
+		return compose.Service{}, p, false, err
+	}
+	name := dbComposeService
+	if name == "" {
+		name = dbViaCompose
+	}
+	if name != "" {
+		s, ok := f.Service(name)
+		if !ok {
+			return compose.Service{}, p, false, fmt.Errorf("service '%s' not found in %s", name, p)
+		}
+		if e := compose.Engine(s.Image); e != engine {
+			return compose.Service{}, p, false, fmt.Errorf("service '%s' in %s runs %q, not %s", s.Name, p, s.Image, engine)
+		}
+		return s, p, true, nil
+	}
+	services := f.ByEngine(engine)
+	switch len(services) {
+	case 0:
+		return compose.Service{}, p, false, nil
+	case 1:
+		return services[0], p, true, nil
+	}
+	var names []string
+	for _, s := range services {
+		names = append(names, s.Name)
+	}
+	return compose.Service{}, p, false, fmt.Errorf("%s has several %s services (%s); pick one with --service", filepath.Base(p), engine, strings.Join(names, ", "))
+}
+
+// composeDefaults returns the settings of the engine's compose service, used where neither a flag
+// nor the environment gives a value. They apply as one set, and only when the host and port come from
+// compose too: a compose password is no good for a host chosen with --host or hostEnv. Under --via-compose
+// the host is not used and the set always applies. Problems with the compose file are reported and the file is ignored.
+func composeDefaults(cmd *cobra.Command, engine, hostEnv, portEnv string) composeSettings {
+	if dbViaCompose == "" {
+		f := cmd.PersistentFlags()
+		if f.Changed("host") || f.Changed("port") || os.Getenv(hostEnv) != "" || os.Getenv(portEnv) != "" {
+			return composeSettings{}
+		}
+	}
+	cs, ok := composeCache[engine]
+	if !ok {
+		cs = readComposeDefaults(engine)
+		composeCache[engine] = cs
+	}
+	if dbViaCompose == "" && cs.Host == "" {
+		return composeSettings{}
+	}
+	return cs
+}
+
+func readComposeDefaults(engine string) composeSettings {
+	s, p, ok, err := findComposeService(engine)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Warning:", err)
+		return composeSettings{}
+	}
+	if !ok {
+		return composeSettings{}
+	}
+	spec := composeEngines[engine]
+	cs := composeSettings{Service: s.Name}
+	if host, port, ok := s.Published(spec.port); ok {
+		cs.Host, cs.Port = host, port
+	} else if dbViaCompose == "" {
+		fmt.Fprintf(os.Stderr, "Warning: service '%s' in %s does not publish port %s; reach it with --via-compose %s.\n", s.Name, filepath.Base(p), spec.port, s.Name)
+	}
+	for _, k := range spec.userVars {
+		if v := s.Environment[k]; v != "" && cs.User == "" {
+			cs.User = v
+		}
+	}
+	if cs.User == "" {
+		cs.User = spec.defaultUser
+	}
+	for _, k := range spec.passVars {
+		if v := s.Environment[k]; v != "" && cs.Password == "" {
+			cs.Password = v
+		}
+	}
+	return cs
+}
+
+// flagOr returns the value of cmd's persistent flag name when it was given on the command line,
+// otherwise fallback, and the flag default when fallback is empty.
+func flagOr(cmd *cobra.Command, name, fallback string) string {
+	f := cmd.PersistentFlags().Lookup(name)
+	if f.Changed || fallback == "" {
+		return f.Value.String()
+	}
+	return fallback
+}
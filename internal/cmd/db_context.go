@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/spf13/cobra"
+)
+
+var dbConnectTimeout, dbStatementTimeout time.Duration
+
+// dbCtx is the context of the running db command: connections and statements run under it,
+// and Ctrl-C or SIGTERM cancel it.
+var dbCtx = context.Background()
+
+var (
+	interruptMu sync.Mutex
+	interruptFn func() // set by a REPL while a statement runs, so Ctrl-C stops only that statement
+)
+
+func init() {
+	dbCmd.PersistentFlags().DurationVar(&dbConnectTimeout, "connect-timeout", 10*time.Second, "give up connecting after this long (0 = no limit)")
+	dbCmd.PersistentFlags().DurationVar(&dbStatementTimeout, "statement-timeout", 0, "abort a statement that runs longer than this (0 = no limit)")
+	dbCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		watchInterrupts()
+	}
+}
+
+// watchInterrupts makes Ctrl-C and SIGTERM cancel dbCtx, or only the running REPL statement.
+// A second Ctrl-C while the first is being handled exits at once.
+func watchInterrupts() {
+	ctx, cancel := context.WithCancel(context.Background())
+	dbCtx = ctx
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			interruptMu.Lock()
+			fn := interruptFn
+			interruptFn = nil
+			interruptMu.Unlock()
+			switch {
+			case fn != nil && sig == os.Interrupt:
+				fn()
+			case ctx.Err() != nil:
+				fmt.Fprintln(os.Stderr, "Interrupted.")
+				os.Exit(130)
+			default:
+				cancel()
+			}
+		}
+	}()
+}
+
+// onInterrupt makes Ctrl-C call fn instead of cancelling the command, until the returned function is called.
+func onInterrupt(fn func()) (restore func()) {
+	interruptMu.Lock()
+	interruptFn = fn
+	interruptMu.Unlock()
+	return func() {
+		interruptMu.Lock()
+		interruptFn = nil
+		interruptMu.Unlock()
+	}
+}
+
+// scanREPLLine reads the next REPL line; Ctrl-C at the prompt leaves the REPL.
+func scanREPLLine(scanner *bufio.Scanner) bool {
+	restore := onInterrupt(func() {
+		fmt.Fprintln(os.Stderr)
+		os.Exit(130)
+	})
+	defer restore()
+	return scanner.Scan()
+}
+
+// sqlREPLSession is the one connection a SQL REPL runs on, so USE and SET carry over between statements.
+type sqlREPLSession struct {
+	pool *sql.DB
+	conn *sql.Conn
+	id   int64
+	// idQuery returns the server's id of the connection; cancelQuery (a format taking that id)
+	// stops its running statement from another connection and leaves the session open.
+	idQuery, cancelQuery string
+}
+
+func openSQLREPLSession(pool *sql.DB, idQuery, cancelQuery string) (*sqlREPLSession, error) {
+	s := &sqlREPLSession{pool: pool, idQuery: idQuery, cancelQuery: cancelQuery}
+	return s, s.connect()
+}
+
+func (s *sqlREPLSession) connect() error {
+	conn, err := s.pool.Conn(dbCtx)
+	if err != nil {
+		return err
+	}
+	if err := conn.QueryRowContext(dbCtx, s.idQuery).Scan(&s.id); err != nil {
+		conn.Close()
+		return err
+	}
+	s.conn = conn
+	return nil
+}
+
+func (s *sqlREPLSession) Close() error {
+	return s.conn.Close()
+}
+
+// run executes stmt and prints its rows or affected row count. Ctrl-C cancels only this statement;
+// a session lost to the statement (e.g. a dropped connection) is replaced by a new one.
+func (s *sqlREPLSession) run(stmt string, f *db.ValueFormatter) {
+	var cancelled atomic.Bool
+	restore := onInterrupt(func() {
+		cancelled.Store(true)
+		fmt.Fprintln(os.Stderr, "Cancelling statement...")
+		if _, err := s.pool.ExecContext(context.Background(), fmt.Sprintf(s.cancelQuery, s.id)); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: cancel:", err)
+		}
+	})
+	defer restore()
+	rows, err := s.conn.QueryContext(dbCtx, stmt)
+	if err != nil {
+		if !cancelled.Load() && dbCtx.Err() == nil {
+			if result, execErr := s.conn.ExecContext(dbCtx, stmt); execErr == nil {
+				affected, _ := result.RowsAffected()
+				fmt.Println("OK", affected, "row(s) affected")
+				return
+			}
+		}
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		if dbCtx.Err() == nil && s.conn.PingContext(dbCtx) != nil {
+			s.conn.Close()
+			if err := s.connect(); err != nil {
+				fmt.Fprintln(os.Stderr, "ERROR: reconnect:", err)
+			} else {
+				fmt.Fprintln(os.Stderr, "Reconnected; session settings were reset.")
+			}
+		}
+		return
+	}
+	if err := printSQLRows(rows, f); err != nil {
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+	}
+	_ = rows.Close()
+}
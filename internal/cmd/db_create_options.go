@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	mysqlDBCharset, mysqlDBCollation                      string
+	pgDBEncoding, pgDBLocale, pgDBCollation, pgDBTemplate string
+	pgDBTimezone                                          string
+)
+
+// safeSetting allows locale, encoding and time zone names such as en_US.UTF-8, de_DE@euro or America/New_York.
+var safeSetting = regexp.MustCompile(`^[a-zA-Z0-9_.@+/-]+$`)
+
+func init() {
+	mysqlCreateDBCmd.Flags().StringVar(&mysqlDBCharset, "charset", "", "default character set (e.g. utf8mb4; default server default)")
+	mysqlCreateDBCmd.Flags().StringVar(&mysqlDBCollation, "collation", "", "default collation (e.g. utf8mb4_0900_ai_ci; default charset default)")
+	f := pgsqlCreateDBCmd.Flags()
+	f.StringVar(&pgDBEncoding, "encoding", "UTF8", "character set encoding")
+	f.StringVar(&pgDBLocale, "locale", "", "LC_COLLATE and LC_CTYPE (e.g. en_US.utf8, C.UTF-8; default server default)")
+	f.StringVar(&pgDBCollation, "collation", "", "LC_COLLATE only, overrides --locale for sorting")
+	f.StringVar(&pgDBTemplate, "template", "template0", "template database")
+	f.StringVar(&pgDBTimezone, "timezone", "", "default timezone for sessions in the database (e.g. UTC, Europe/Berlin)")
+}
+
+func requireSafeSetting(value, kind string) error {
+	if !safeSetting.MatchString(value) {
+		return fmt.Errorf("invalid %s %q", kind, value)
+	}
+	return nil
+}
+
+// mysqlDatabaseOptions are the CREATE DATABASE defaults; empty fields use the server's.
+type mysqlDatabaseOptions struct {
+	charset, collation string
+}
+
+// validate checks the charset and collation exist on the server and belong together.
+func (o mysqlDatabaseOptions) validate(conn *sql.DB) error {
+	if o.charset != "" {
+		if err := requireSafeIdent(o.charset, "charset"); err != nil {
+			return err
+		}
+		var n int
+		if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM information_schema.character_sets WHERE character_set_name = ?", o.charset).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("charset %q is not available on this server (see SHOW CHARACTER SET)", o.charset)
+		}
+	}
+	if o.collation == "" {
+		return nil
+	}
+	if err := requireSafeIdent(o.collation, "collation"); err != nil {
+		return err
+	}
+	var charset string
+	err := conn.QueryRowContext(dbCtx, "SELECT character_set_name FROM information_schema.collations WHERE collation_name = ?", o.collation).Scan(&charset)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("collation %q is not available on this server (see SHOW COLLATION)", o.collation)
+	}
+	if err != nil {
+		return err
+	}
+	if o.charset != "" && charset != o.charset {
+		return fmt.Errorf("collation %q belongs to charset %q, not %q", o.collation, charset, o.charset)
+	}
+	return nil
+}
+
+func (o mysqlDatabaseOptions) clauses() string {
+	s := ""
+	if o.charset != "" {
+		s += " CHARACTER SET " + o.charset
+	}
+	if o.collation != "" {
+		s += " COLLATE " + o.collation
+	}
+	return s
+}
+
+// pgDatabaseOptions are the CREATE DATABASE settings; the zero value means UTF8 from template0 with the server locale.
+type pgDatabaseOptions struct {
+	encoding, locale, collation, template, timezone string
+}
+
+// validate checks every setting against what the server offers.
+func (o pgDatabaseOptions) validate(conn *sql.DB) error {
+	if o.encoding != "" {
+		if err := requireSafeSetting(o.encoding, "encoding"); err != nil {
+			return err
+		}
+		var valid bool
+		if err := conn.QueryRowContext(dbCtx, "SELECT pg_char_to_encoding($1) >= 0", o.encoding).Scan(&valid); err != nil {
+			return err
+		}
+		if !valid {
+			return fmt.Errorf("encoding %q is not supported by this server", o.encoding)
+		}
+	}
+	for _, l := range []struct{ value, kind string }{{o.locale, "locale"}, {o.collation, "collation"}} {
+		if l.value == "" {
+			continue
+		}
+		if err := requireSafeSetting(l.value, l.kind); err != nil {
+			return err
+		}
+		// pg_collation holds the OS locales imported at initdb (none on musl images), the databases show the
+		// locales the cluster already runs with. The C library accepts the codeset in any spelling, so
+		// C.UTF-8 matches C.utf8.
+		var n int
+		if err := conn.QueryRowContext(dbCtx, `SELECT COUNT(*) FROM (
+  SELECT collcollate::text AS l FROM pg_collation
+  UNION ALL SELECT datcollate::text FROM pg_database
+  UNION ALL SELECT datctype::text FROM pg_database
+) s WHERE lower(replace(l, '-', '')) = lower(replace($1, '-', ''))`, l.value).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%s %q is not available on this server (see SELECT collcollate FROM pg_collation)", l.kind, l.value)
+		}
+	}
+	if o.template != "" {
+		if err := requireSafeIdent(o.template, "template"); err != nil {
+			return err
+		}
+		exists, err := pgDBExists(conn, o.template)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("template database %q does not exist", o.template)
+		}
+	}
+	if o.timezone != "" {
+		if err := requireSafeSetting(o.timezone, "timezone"); err != nil {
+			return err
+		}
+		var n int
+		if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM pg_timezone_names WHERE name = $1", o.timezone).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("timezone %q is not known to this server (see pg_timezone_names)", o.timezone)
+		}
+	}
+	return nil
+}
+
+func (o pgDatabaseOptions) clauses() string {
+	encoding, template := o.encoding, o.template
+	if encoding == "" {
+		encoding = "UTF8"
+	}
+	if template == "" {
+		template = "template0"
+	}
+	parts := []string{"ENCODING '" + encoding + "'"}
+	collate, ctype := o.locale, o.locale
+	if o.collation != "" {
+		collate = o.collation
+	}
+	if collate != "" {
+		parts = append(parts, "LC_COLLATE '"+collate+"'")
+	}
+	if ctype != "" {
+		parts = append(parts, "LC_CTYPE '"+ctype+"'")
+	}
+	parts = append(parts, `TEMPLATE "`+template+`"`)
+	return strings.Join(parts, " ")
+}
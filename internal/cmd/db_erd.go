@@ -0,0 +1,463 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	erdFormat  string
+	erdColumns string
+	erdInclude []string
+	erdExclude []string
+	erdSchemas []string
+)
+
+var (
+	mysqlERDCmd = &cobra.Command{
+		Use:   "erd <database>",
+		Short: "Print an entity-relationship diagram of a database (Mermaid, Graphviz DOT or PlantUML)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlERD,
+	}
+	pgsqlERDCmd = &cobra.Command{
+		Use:   "erd <database>",
+		Short: "Print an entity-relationship diagram of a database (Mermaid, Graphviz DOT or PlantUML)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlERD,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{mysqlERDCmd, pgsqlERDCmd} {
+		c.Flags().StringVar(&erdFormat, "format", "mermaid", "diagram format: mermaid, dot or plantuml")
+		c.Flags().StringVar(&erdColumns, "columns", "all", "columns to show: all, keys (primary and foreign keys only) or none")
+		c.Flags().StringSliceVar(&erdInclude, "include", nil, "only tables matching these glob patterns (comma-separated)")
+		c.Flags().StringSliceVar(&erdExclude, "exclude", nil, "leave out tables matching these glob patterns (comma-separated)")
+	}
+	pgsqlERDCmd.Flags().StringSliceVar(&erdSchemas, "schema", []string{"public"}, "schemas to read; tables outside public are named schema.table")
+	mysqlCmd.AddCommand(mysqlERDCmd)
+	pgsqlCmd.AddCommand(pgsqlERDCmd)
+}
+
+type erdColumn struct {
+	Name, Type string
+	Nullable   bool
+	PK, FK     bool
+}
+
+type erdTable struct {
+	Name    string
+	Columns []erdColumn
+}
+
+// erdRelation is a foreign key from Child.Columns to Parent.RefColumns.
+type erdRelation struct {
+	Name               string
+	Child, Parent      string
+	Columns, RefCols   []string
+	Optional, OneToOne bool
+}
+
+// erdSchema holds tables in catalog order; tables and relations are added by name.
+type erdSchema struct {
+	Tables    []*erdTable
+	Relations []*erdRelation
+	byName    map[string]*erdTable
+}
+
+func (s *erdSchema) addColumn(table string, col erdColumn) {
+	if s.byName == nil {
+		s.byName = map[string]*erdTable{}
+	}
+	t := s.byName[table]
+	if t == nil {
+		t = &erdTable{Name: table}
+		s.byName[table] = t
+		s.Tables = append(s.Tables, t)
+	}
+	t.Columns = append(t.Columns, col)
+}
+
+// addReference adds one column pair of foreign key name; pairs of the same key arrive in order.
+func (s *erdSchema) addReference(name, child, column, parent, refColumn string) {
+	if n := len(s.Relations); n > 0 {
+		if r := s.Relations[n-1]; r.Name == name && r.Child == child {
+			r.Columns = append(r.Columns, column)
+			r.RefCols = append(r.RefCols, refColumn)
+			return
+		}
+	}
+	s.Relations = append(s.Relations, &erdRelation{Name: name, Child: child, Parent: parent, Columns: []string{column}, RefCols: []string{refColumn}})
+}
+
+func erdMatch(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(strings.TrimSpace(p), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// finish applies --include, --exclude and --columns, marks foreign key columns and
+// works out each relation's cardinality. Relations to a table left out are dropped.
+func (s *erdSchema) finish() error {
+	switch erdColumns {
+	case "all", "keys", "none":
+	default:
+		return fmt.Errorf("invalid --columns %q (use all, keys or none)", erdColumns)
+	}
+	kept := map[string]bool{}
+	var tables []*erdTable
+	for _, t := range s.Tables {
+		if (len(erdInclude) > 0 && !erdMatch(erdInclude, t.Name)) || erdMatch(erdExclude, t.Name) {
+			continue
+		}
+		kept[t.Name] = true
+		tables = append(tables, t)
+	}
+	s.Tables = tables
+	var relations []*erdRelation
+	for _, r := range s.Relations {
+		child := s.byName[r.Child]
+		if child == nil {
+			continue
+		}
+		fk := map[string]bool{}
+		for _, c := range r.Columns {
+			fk[c] = true
+		}
+		r.Optional = true
+		pkCols, pkInKey := 0, 0
+		for i, c := range child.Columns {
+			if fk[c.Name] {
+				child.Columns[i].FK = true
+				if !c.Nullable {
+					r.Optional = false
+				}
+			}
+			if c.PK {
+				pkCols++
+				if fk[c.Name] {
+					pkInKey++
+				}
+			}
+		}
+		// The key is also the child's primary key: at most one child row per parent row.
+		r.OneToOne = pkCols == len(r.Columns) && pkInKey == pkCols
+		if kept[r.Child] && kept[r.Parent] {
+			relations = append(relations, r)
+		}
+	}
+	s.Relations = relations
+	for _, t := range s.Tables {
+		var cols []erdColumn
+		for _, c := range t.Columns {
+			if erdColumns == "all" || (erdColumns == "keys" && (c.PK || c.FK)) {
+				cols = append(cols, c)
+			}
+		}
+		t.Columns = cols
+	}
+	return nil
+}
+
+func (s *erdSchema) write(w io.Writer) error {
+	switch erdFormat {
+	case "mermaid":
+		return s.writeMermaid(w)
+	case "dot":
+		return s.writeDOT(w)
+	case "plantuml":
+		return s.writePlantUML(w)
+	}
+	return fmt.Errorf("invalid --format %q (use mermaid, dot or plantuml)", erdFormat)
+}
+
+var (
+	erdUnsafe   = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	mermaidType = regexp.MustCompile(`[^A-Za-z0-9_()\[\]-]+`) // Mermaid attribute types are a single word
+)
+
+// erdIdent makes name usable as an unquoted Mermaid entity or PlantUML alias.
+func erdIdent(name string) string {
+	return erdUnsafe.ReplaceAllString(name, "_")
+}
+
+func (c erdColumn) keys() []string {
+	var keys []string
+	if c.PK {
+		keys = append(keys, "PK")
+	}
+	if c.FK {
+		keys = append(keys, "FK")
+	}
+	return keys
+}
+
+func (s *erdSchema) writeMermaid(w io.Writer) error {
+	fmt.Fprintln(w, "erDiagram")
+	for _, t := range s.Tables {
+		if len(t.Columns) == 0 {
+			fmt.Fprintf(w, "    %s\n", erdIdent(t.Name))
+			continue
+		}
+		fmt.Fprintf(w, "    %s {\n", erdIdent(t.Name))
+		for _, c := range t.Columns {
+			line := fmt.Sprintf("        %s %s", mermaidType.ReplaceAllString(c.Type, "_"), erdIdent(c.Name))
+			if keys := c.keys(); len(keys) > 0 {
+				line += " " + strings.Join(keys, ", ")
+			}
+			fmt.Fprintln(w, line)
+		}
+		fmt.Fprintln(w, "    }")
+	}
+	for _, r := range s.Relations {
+		fmt.Fprintf(w, "    %s %s %s : %q\n", erdIdent(r.Parent), r.crowsFoot(), erdIdent(r.Child), strings.Join(r.Columns, ", "))
+	}
+	return nil
+}
+
+// crowsFoot is the parent-to-child crow's foot notation shared by Mermaid and PlantUML.
+func (r *erdRelation) crowsFoot() string {
+	parent, child := "||", "o{"
+	if r.Optional {
+		parent = "|o"
+	}
+	if r.OneToOne {
+		child = "o|"
+	}
+	return parent + "--" + child
+}
+
+func (s *erdSchema) writeDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph erd {")
+	fmt.Fprintln(w, "  graph [rankdir=LR];")
+	fmt.Fprintln(w, `  node [shape=plaintext, fontname="Helvetica", fontsize=10];`)
+	fmt.Fprintln(w, "  edge [dir=both];")
+	ports := map[string]bool{}
+	for _, t := range s.Tables {
+		fmt.Fprintf(w, "  %q [label=<<table border=\"0\" cellborder=\"1\" cellspacing=\"0\" cellpadding=\"4\">\n", t.Name)
+		fmt.Fprintf(w, "    <tr><td bgcolor=\"lightgrey\"><b>%s</b></td></tr>\n", html.EscapeString(t.Name))
+		for _, c := range t.Columns {
+			label := html.EscapeString(c.Name) + " : " + html.EscapeString(c.Type)
+			if keys := c.keys(); len(keys) > 0 {
+				label = "<b>" + label + "</b> (" + strings.Join(keys, ", ") + ")"
+			}
+			fmt.Fprintf(w, "    <tr><td port=\"%s\" align=\"left\">%s</td></tr>\n", html.EscapeString(c.Name), label)
+			ports[t.Name+"\x00"+c.Name] = true
+		}
+		fmt.Fprintln(w, "  </table>>];")
+	}
+	for _, r := range s.Relations {
+		// Point from the first key column to the column it references when both are shown.
+		from, to := fmt.Sprintf("%q", r.Child), fmt.Sprintf("%q", r.Parent)
+		if ports[r.Child+"\x00"+r.Columns[0]] && ports[r.Parent+"\x00"+r.RefCols[0]] {
+			from += fmt.Sprintf(":%q", r.Columns[0])
+			to += fmt.Sprintf(":%q", r.RefCols[0])
+		}
+		tail, head := "crowodot", "tee"
+		if r.OneToOne {
+			tail = "teeodot"
+		}
+		if r.Optional {
+			head = "teeodot"
+		}
+		fmt.Fprintf(w, "  %s -> %s [arrowtail=%s, arrowhead=%s, tooltip=%q];\n", from, to, tail, head, r.Name)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+func (s *erdSchema) writePlantUML(w io.Writer) error {
+	fmt.Fprintln(w, "@startuml")
+	fmt.Fprintln(w, "hide circle")
+	fmt.Fprintln(w, "skinparam linetype ortho")
+	for _, t := range s.Tables {
+		fmt.Fprintf(w, "entity %q as %s {\n", t.Name, erdIdent(t.Name))
+		var keys, rest []erdColumn
+		for _, c := range t.Columns {
+			if c.PK {
+				keys = append(keys, c)
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		for i, cols := range [][]erdColumn{keys, rest} {
+			if i == 1 && len(keys) > 0 && len(rest) > 0 {
+				fmt.Fprintln(w, "  --")
+			}
+			for _, c := range cols {
+				line := "  "
+				if !c.Nullable {
+					line += "* " // mandatory
+				}
+				line += c.Name + " : " + c.Type
+				for _, k := range c.keys() {
+					line += " <<" + k + ">>"
+				}
+				fmt.Fprintln(w, line)
+			}
+		}
+		fmt.Fprintln(w, "}")
+	}
+	for _, r := range s.Relations {
+		fmt.Fprintf(w, "%s %s %s : %s\n", erdIdent(r.Parent), r.crowsFoot(), erdIdent(r.Child), strings.Join(r.Columns, ", "))
+	}
+	_, err := fmt.Fprintln(w, "@enduml")
+	return err
+}
+
+func runMysqlERD(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	conn, err := openMySQL(getMySQLConfig())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	schema, err := readMySQLERD(conn, args[0])
+	if err != nil {
+		return err
+	}
+	if err := schema.finish(); err != nil {
+		return err
+	}
+	return schema.write(os.Stdout)
+}
+
+func readMySQLERD(conn *sql.DB, database string) (*erdSchema, error) {
+	schema := &erdSchema{}
+	rows, err := conn.QueryContext(dbCtx, `SELECT c.table_name, c.column_name, c.column_type, c.is_nullable = 'YES', c.column_key = 'PRI'
+		FROM information_schema.columns c
+		JOIN information_schema.tables t ON t.table_schema = c.table_schema AND t.table_name = c.table_name
+		WHERE c.table_schema = ? AND t.table_type = 'BASE TABLE'
+		ORDER BY c.table_name, c.ordinal_position`, database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var table string
+		var c erdColumn
+		if err := rows.Scan(&table, &c.Name, &c.Type, &c.Nullable, &c.PK); err != nil {
+			return nil, err
+		}
+		schema.addColumn(table, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(schema.Tables) == 0 {
+		return nil, fmt.Errorf("no tables found in database %s", database)
+	}
+	refs, err := conn.QueryContext(dbCtx, `SELECT constraint_name, table_name, column_name, referenced_table_name, referenced_column_name
+		FROM information_schema.key_column_usage
+		WHERE table_schema = ? AND referenced_table_schema = ?
+		ORDER BY table_name, constraint_name, ordinal_position`, database, database)
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+	for refs.Next() {
+		var name, child, column, parent, refColumn string
+		if err := refs.Scan(&name, &child, &column, &parent, &refColumn); err != nil {
+			return nil, err
+		}
+		schema.addReference(name, child, column, parent, refColumn)
+	}
+	return schema, refs.Err()
+}
+
+func runPgsqlERD(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	cfg := getPgConfig()
+	cfg.Database = args[0]
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	schema, err := readPgERD(conn)
+	if err != nil {
+		return err
+	}
+	if err := schema.finish(); err != nil {
+		return err
+	}
+	return schema.write(os.Stdout)
+}
+
+// pgERDName names a table by itself in public and as schema.table elsewhere.
+func pgERDName(schema, table string) string {
+	if schema == "public" {
+		return table
+	}
+	return schema + "." + table
+}
+
+func readPgERD(conn *sql.DB) (*erdSchema, error) {
+	schema := &erdSchema{}
+	rows, err := conn.QueryContext(dbCtx, `SELECT n.nspname, c.relname, a.attname, format_type(a.atttypid, a.atttypmod),
+			NOT a.attnotnull, COALESCE(a.attnum = ANY(pk.conkey), false)
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_constraint pk ON pk.conrelid = c.oid AND pk.contype = 'p'
+		WHERE c.relkind IN ('r', 'p') AND NOT c.relispartition AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname, a.attnum`, pq.Array(erdSchemas))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nsp, table string
+		var c erdColumn
+		if err := rows.Scan(&nsp, &table, &c.Name, &c.Type, &c.Nullable, &c.PK); err != nil {
+			return nil, err
+		}
+		schema.addColumn(pgERDName(nsp, table), c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(schema.Tables) == 0 {
+		return nil, fmt.Errorf("no tables found in schema %s", strings.Join(erdSchemas, ", "))
+	}
+	refs, err := conn.QueryContext(dbCtx, `SELECT con.conname, n.nspname, c.relname, a.attname, rn.nspname, rc.relname, ra.attname
+		FROM pg_constraint con
+		JOIN pg_class c ON c.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_class rc ON rc.oid = con.confrelid
+		JOIN pg_namespace rn ON rn.oid = rc.relnamespace
+		CROSS JOIN LATERAL unnest(con.conkey, con.confkey) WITH ORDINALITY AS k(attnum, refnum, ord)
+		JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = k.attnum
+		JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = k.refnum
+		WHERE con.contype = 'f' AND n.nspname = ANY($1)
+		ORDER BY n.nspname, c.relname, con.conname, k.ord`, pq.Array(erdSchemas))
+	if err != nil {
+		return nil, err
+	}
+	defer refs.Close()
+	for refs.Next() {
+		var name, nsp, child, column, refNsp, parent, refColumn string
+		if err := refs.Scan(&name, &nsp, &child, &column, &refNsp, &parent, &refColumn); err != nil {
+			return nil, err
+		}
+		schema.addReference(name, pgERDName(nsp, child), column, pgERDName(refNsp, parent), refColumn)
+	}
+	return schema, refs.Err()
+}
@@ -0,0 +1,563 @@
+package cmd
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Privilege presets accepted by grant/revoke --preset.
+const (
+	presetReadonly  = "readonly"
+	presetReadwrite = "readwrite"
+	presetDDL       = "ddl"
+	presetOwner     = "owner"
+)
+
+var (
+	mysqlGrantPreset, pgGrantPreset, mongoGrantPreset    string
+	mysqlRevokePreset, pgRevokePreset, mongoRevokePreset string
+)
+
+func checkPreset(p string) error {
+	switch p {
+	case presetReadonly, presetReadwrite, presetDDL, presetOwner:
+		return nil
+	}
+	return fmt.Errorf("invalid preset %q (use readonly, readwrite, ddl or owner)", p)
+}
+
+const (
+	mysqlReadonlyPrivs  = "SELECT, SHOW VIEW"
+	mysqlReadwritePrivs = mysqlReadonlyPrivs + ", INSERT, UPDATE, DELETE, CREATE TEMPORARY TABLES, LOCK TABLES, EXECUTE"
+	mysqlDDLPrivs       = mysqlReadwritePrivs + ", CREATE, ALTER, DROP, INDEX, REFERENCES, CREATE VIEW, CREATE ROUTINE, ALTER ROUTINE, TRIGGER, EVENT"
+)
+
+// mysqlPresetPrivileges maps a preset to the privilege list used in GRANT/REVOKE ... ON `db`.*.
+var mysqlPresetPrivileges = map[string]string{
+	presetReadonly:  mysqlReadonlyPrivs,
+	presetReadwrite: mysqlReadwritePrivs,
+	presetDDL:       mysqlDDLPrivs,
+	presetOwner:     "ALL PRIVILEGES",
+}
+
+// pgPresetPrivileges holds the privileges a preset grants at each PostgreSQL object level.
+type pgPresetPrivileges struct {
+	database, schema, tables, sequences, functions string
+}
+
+var pgPresets = map[string]pgPresetPrivileges{
+	presetReadonly:  {database: "CONNECT", schema: "USAGE", tables: "SELECT", sequences: "SELECT"},
+	presetReadwrite: {database: "CONNECT, TEMPORARY", schema: "USAGE", tables: "SELECT, INSERT, UPDATE, DELETE", sequences: "USAGE, SELECT, UPDATE", functions: "EXECUTE"},
+	presetDDL:       {database: "CONNECT, TEMPORARY, CREATE", schema: "USAGE, CREATE", tables: "ALL PRIVILEGES", sequences: "ALL PRIVILEGES", functions: "EXECUTE"},
+	presetOwner:     {database: "ALL PRIVILEGES", schema: "ALL PRIVILEGES", tables: "ALL PRIVILEGES", sequences: "ALL PRIVILEGES", functions: "ALL PRIVILEGES"},
+}
+
+// pgPresetStatements returns the database-level statements (run from any database) and the
+// schema-level statements (run while connected to database) for a preset grant or revoke.
+func pgPresetStatements(preset, database, schema, user string, revoke bool) (dbLevel, schemaLevel []string) {
+	p := pgPresets[preset]
+	verb, prep := "GRANT ", ` TO "`+user+`"`
+	if revoke {
+		verb, prep = "REVOKE ", ` FROM "`+user+`"`
+	}
+	dbLevel = []string{verb + p.database + ` ON DATABASE "` + database + `"` + prep}
+	schemaLevel = []string{
+		verb + p.schema + ` ON SCHEMA "` + schema + `"` + prep,
+		verb + p.tables + ` ON ALL TABLES IN SCHEMA "` + schema + `"` + prep,
+		verb + p.sequences + ` ON ALL SEQUENCES IN SCHEMA "` + schema + `"` + prep,
+	}
+	if p.functions != "" {
+		schemaLevel = append(schemaLevel, verb+p.functions+` ON ALL FUNCTIONS IN SCHEMA "`+schema+`"`+prep)
+	}
+	return dbLevel, schemaLevel
+}
+
+// mongoPresetRoles maps a preset to built-in database roles.
+var mongoPresetRoles = map[string][]string{
+	presetReadonly:  {"read"},
+	presetReadwrite: {"readWrite"},
+	presetDDL:       {"readWrite", "dbAdmin"},
+	presetOwner:     {"dbOwner"},
+}
+
+// mongoRoleArgs resolves [username] [role] [database] or [username] [database] with --preset into roles.
+func mongoRoleArgs(args []string, preset string) (username string, roles bson.A, database string, err error) {
+	username = args[0]
+	switch {
+	case len(args) == 3 && preset != "":
+		return "", nil, "", fmt.Errorf("pass either a role or --preset, not both")
+	case len(args) == 3:
+		database = args[2]
+		roles = bson.A{bson.D{{Key: "role", Value: args[1]}, {Key: "db", Value: database}}}
+	case preset != "":
+		if err := checkPreset(preset); err != nil {
+			return "", nil, "", err
+		}
+		database = args[1]
+		for _, r := range mongoPresetRoles[preset] {
+			roles = append(roles, bson.D{{Key: "role", Value: r}, {Key: "db", Value: database}})
+		}
+	default:
+		return "", nil, "", fmt.Errorf("role required: [username] [role] [database], or [username] [database] --preset")
+	}
+	if err := requireSafeIdent(username, "username"); err != nil {
+		return "", nil, "", err
+	}
+	if err := requireSafeIdent(database, "database"); err != nil {
+		return "", nil, "", err
+	}
+	return username, roles, database, nil
+}
+
+var (
+	mysqlRevokeCmd = &cobra.Command{
+		Use:   "revoke [database] [username]",
+		Short: "Revoke privileges on database from user (all, or a --preset)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runMysqlRevoke,
+	}
+	pgsqlRevokeCmd = &cobra.Command{
+		Use:   "revoke [database] [username]",
+		Short: "Revoke privileges on database and its public schema from user (all, or a --preset)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlRevoke,
+	}
+	mongoRevokeCmd = &cobra.Command{
+		Use:   "revoke [username] [role] [database]",
+		Short: "Revoke role on database from user (or [username] [database] --preset)",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE:  runMongoRevoke,
+	}
+	mysqlShowGrantsCmd = &cobra.Command{
+		Use:   "show-grants [username]",
+		Short: "Show effective privileges of a user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlShowGrants,
+	}
+	pgsqlShowGrantsCmd = &cobra.Command{
+		Use:   "show-grants [username]",
+		Short: "Show effective privileges and role memberships of a user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlShowGrants,
+	}
+	mongoShowGrantsCmd = &cobra.Command{
+		Use:   "show-grants [username]",
+		Short: "Show roles granted to a user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMongoShowGrants,
+	}
+)
+
+func init() {
+	presetHelp := "privilege preset: readonly, readwrite, ddl or owner"
+	mysqlGrantCmd.Flags().StringVar(&mysqlGrantPreset, "preset", presetOwner, presetHelp)
+	pgsqlGrantCmd.Flags().StringVar(&pgGrantPreset, "preset", presetOwner, presetHelp)
+	mongoGrantCmd.Flags().StringVar(&mongoGrantPreset, "preset", "", presetHelp+" (instead of [role])")
+	mysqlRevokeCmd.Flags().StringVar(&mysqlRevokePreset, "preset", presetOwner, presetHelp+" (owner revokes everything)")
+	pgsqlRevokeCmd.Flags().StringVar(&pgRevokePreset, "preset", presetOwner, presetHelp+" (owner revokes everything)")
+	mongoRevokeCmd.Flags().StringVar(&mongoRevokePreset, "preset", "", presetHelp+" (instead of [role])")
+	mysqlCmd.AddCommand(mysqlRevokeCmd, mysqlShowGrantsCmd)
+	pgsqlCmd.AddCommand(pgsqlRevokeCmd, pgsqlShowGrantsCmd)
+	mongoCmd.AddCommand(mongoRevokeCmd, mongoShowGrantsCmd)
+}
+
+// grantRow is one line of show-grants output, shared by all engines.
+type grantRow struct {
+	principal, scope, object string
+	privileges               []string
+}
+
+var grantScopeOrder = map[string]int{"global": 0, "database": 1, "schema": 2, "table": 3, "role": 4}
+
+func printGrants(rows []grantRow) error {
+	if len(rows) == 0 {
+		fmt.Println("No privileges.")
+		return nil
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.principal != b.principal {
+			return a.principal < b.principal
+		}
+		if grantScopeOrder[a.scope] != grantScopeOrder[b.scope] {
+			return grantScopeOrder[a.scope] < grantScopeOrder[b.scope]
+		}
+		return a.object < b.object
+	})
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PRINCIPAL\tSCOPE\tOBJECT\tPRIVILEGES")
+	for _, r := range rows {
+		privs := append([]string(nil), r.privileges...)
+		sort.Strings(privs)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.principal, r.scope, r.object, strings.Join(privs, ", "))
+	}
+	return w.Flush()
+}
+
+func runMysqlRevoke(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[1], "username"); err != nil {
+		return err
+	}
+	if err := checkPreset(mysqlRevokePreset); err != nil {
+		return err
+	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
+	database, username := args[0], args[1]
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	err = execSQL(conn, "REVOKE "+mysqlPresetPrivileges[mysqlRevokePreset]+" ON `"+database+"`.* FROM "+mysqlAccount(username, mysqlAccountHost))
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1141 {
+		return noop("User '" + username + "' has no such privileges on '" + database + "'.")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Revoked.")
+	return nil
+}
+
+func runPgsqlRevoke(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[1], "username"); err != nil {
+		return err
+	}
+	if err := checkPreset(pgRevokePreset); err != nil {
+		return err
+	}
+	database, username := args[0], args[1]
+	dbLevel, schemaLevel := pgPresetStatements(pgRevokePreset, database, "public", username, true)
+	if err := runPgPresetStatements(database, dbLevel, schemaLevel); err != nil {
+		return err
+	}
+	fmt.Println("Revoked.")
+	return nil
+}
+
+// runPgPresetStatements runs dbLevel from the maintenance database and schemaLevel inside database.
+func runPgPresetStatements(database string, dbLevel, schemaLevel []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for _, q := range dbLevel {
+		if err := execSQL(conn, q); err != nil {
+			return err
+		}
+	}
+	cfg.Database = database
+	dconn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer dconn.Close()
+	for _, q := range schemaLevel {
+		if err := execSQL(dconn, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runMongoRevoke(cmd *cobra.Command, args []string) error {
+	username, roles, _, err := mongoRoleArgs(args, mongoRevokePreset)
+	if err != nil {
+		return err
+	}
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	cmdDoc := bson.D{
+		{Key: "revokeRolesFromUser", Value: username},
+		{Key: "roles", Value: roles},
+	}
+	if err := runMongoCommand(ctx, mongoDriver{client}, "admin", cmdDoc); err != nil {
+		return err
+	}
+	fmt.Println("Revoked.")
+	return nil
+}
+
+func runMysqlShowGrants(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	username := args[0]
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Grants of every host of username are shown.
+	if exists, err := mysqlUserExists(conn, username, ""); err != nil {
+		return err
+	} else if !exists {
+		fmt.Println("User '" + username + "' does not exist.")
+		return nil
+	}
+	prefix := "'" + username + "'@"
+	grouped := map[[3]string][]string{}
+	var order [][3]string
+	for _, src := range []struct{ scope, query string }{
+		{"global", "SELECT grantee, '*.*', privilege_type, is_grantable FROM information_schema.user_privileges"},
+		{"database", "SELECT grantee, CONCAT(table_schema, '.*'), privilege_type, is_grantable FROM information_schema.schema_privileges"},
+		{"table", "SELECT grantee, CONCAT(table_schema, '.', table_name), privilege_type, is_grantable FROM information_schema.table_privileges"},
+	} {
+		rows, err := conn.QueryContext(dbCtx, src.query)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var grantee, object, priv, grantable string
+			if err := rows.Scan(&grantee, &object, &priv, &grantable); err != nil {
+				rows.Close()
+				return err
+			}
+			if !strings.HasPrefix(grantee, prefix) || priv == "USAGE" {
+				continue
+			}
+			key := [3]string{strings.ReplaceAll(grantee, "'", ""), src.scope, object}
+			if _, ok := grouped[key]; !ok {
+				order = append(order, key)
+			}
+			grouped[key] = append(grouped[key], priv)
+			if grantable == "YES" && !containsString(grouped[key], "GRANT OPTION") {
+				grouped[key] = append(grouped[key], "GRANT OPTION")
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	var out []grantRow
+	for _, k := range order {
+		out = append(out, grantRow{principal: k[0], scope: k[1], object: k[2], privileges: grouped[k]})
+	}
+	return printGrants(out)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func runPgsqlShowGrants(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	username := args[0]
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var super, createdb, createrole bool
+	err = conn.QueryRowContext(dbCtx, "SELECT rolsuper, rolcreatedb, rolcreaterole FROM pg_roles WHERE rolname = $1", username).
+		Scan(&super, &createdb, &createrole)
+	if err == sql.ErrNoRows {
+		fmt.Println("User '" + username + "' does not exist.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var out []grantRow
+	var attrs []string
+	for _, a := range []struct {
+		on   bool
+		name string
+	}{{super, "SUPERUSER"}, {createdb, "CREATEDB"}, {createrole, "CREATEROLE"}} {
+		if a.on {
+			attrs = append(attrs, a.name)
+		}
+	}
+	if len(attrs) > 0 {
+		out = append(out, grantRow{principal: username, scope: "global", object: "*", privileges: attrs})
+	}
+
+	rows, err := conn.QueryContext(dbCtx, `SELECT r.rolname FROM pg_auth_members m
+		JOIN pg_roles r ON r.oid = m.roleid JOIN pg_roles u ON u.oid = m.member WHERE u.rolname = $1`, username)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			rows.Close()
+			return err
+		}
+		out = append(out, grantRow{principal: username, scope: "role", object: role, privileges: []string{"MEMBER"}})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	dbRows, err := pgACLGrants(conn, username, "database", `SELECT d.datname, string_agg(a.privilege_type, ',')
+		FROM pg_database d, aclexplode(COALESCE(d.datacl, acldefault('d', d.datdba))) a
+		WHERE a.grantee = (SELECT oid FROM pg_roles WHERE rolname = $1) GROUP BY d.datname`)
+	if err != nil {
+		return err
+	}
+	out = append(out, dbRows...)
+
+	// Schema and table ACLs live in each database's catalog.
+	names, err := conn.QueryContext(dbCtx, "SELECT datname FROM pg_database WHERE datistemplate = false AND datallowconn ORDER BY datname")
+	if err != nil {
+		return err
+	}
+	var databases []string
+	for names.Next() {
+		var n string
+		if err := names.Scan(&n); err != nil {
+			names.Close()
+			return err
+		}
+		databases = append(databases, n)
+	}
+	names.Close()
+	if err := names.Err(); err != nil {
+		return err
+	}
+	for _, database := range databases {
+		dcfg := cfg
+		dcfg.Database = database
+		dconn, err := openPg(dcfg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", database, err)
+			continue
+		}
+		schemaRows, err := pgACLGrants(dconn, username, "schema", `SELECT current_database() || '.' || n.nspname, string_agg(a.privilege_type, ',')
+			FROM pg_namespace n, aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+			WHERE a.grantee = (SELECT oid FROM pg_roles WHERE rolname = $1)
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%' AND n.nspname NOT LIKE 'pg_temp%'
+			GROUP BY n.nspname`)
+		if err == nil {
+			var tableRows []grantRow
+			tableRows, err = pgACLGrants(dconn, username, "table", `SELECT current_database() || '.' || n.nspname || '.' || c.relname, string_agg(a.privilege_type, ',')
+				FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace,
+				aclexplode(COALESCE(c.relacl, acldefault(CASE WHEN c.relkind = 'S' THEN 's' ELSE 'r' END::"char", c.relowner))) a
+				WHERE a.grantee = (SELECT oid FROM pg_roles WHERE rolname = $1) AND c.relkind IN ('r', 'v', 'm', 'p', 'f', 'S')
+				AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+				GROUP BY n.nspname, c.relname`)
+			out = append(out, schemaRows...)
+			out = append(out, tableRows...)
+		}
+		dconn.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: schema and table privileges not shown: %v\n", database, err)
+		}
+	}
+	return printGrants(out)
+}
+
+// pgACLGrants runs a query returning (object, comma-separated privileges) for username.
+func pgACLGrants(conn *sql.DB, username, scope, query string) ([]grantRow, error) {
+	rows, err := conn.QueryContext(dbCtx, query, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []grantRow
+	for rows.Next() {
+		var object, privs string
+		if err := rows.Scan(&object, &privs); err != nil {
+			return nil, err
+		}
+		out = append(out, grantRow{principal: username, scope: scope, object: object, privileges: strings.Split(privs, ",")})
+	}
+	return out, rows.Err()
+}
+
+// mongoServerRoles are built-in admin roles that apply to every database or the whole cluster.
+var mongoServerRoles = map[string]bool{
+	"root": true, "readAnyDatabase": true, "readWriteAnyDatabase": true, "userAdminAnyDatabase": true,
+	"dbAdminAnyDatabase": true, "clusterAdmin": true, "clusterManager": true, "clusterMonitor": true,
+	"hostManager": true, "backup": true, "restore": true,
+}
+
+func runMongoShowGrants(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	username := args[0]
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	var result struct {
+		Users []struct {
+			User  string `bson:"user"`
+			DB    string `bson:"db"`
+			Roles []struct {
+				Role string `bson:"role"`
+				DB   string `bson:"db"`
+			} `bson:"roles"`
+		} `bson:"users"`
+	}
+	if err := client.Database("admin").RunCommand(ctx, bson.D{{Key: "usersInfo", Value: username}}).Decode(&result); err != nil {
+		return err
+	}
+	if len(result.Users) == 0 {
+		fmt.Println("User '" + username + "' does not exist.")
+		return nil
+	}
+	grouped := map[[2]string][]string{}
+	for _, u := range result.Users {
+		for _, r := range u.Roles {
+			scope := "database"
+			if r.DB == "admin" && mongoServerRoles[r.Role] {
+				scope = "global"
+			}
+			key := [2]string{scope, r.DB}
+			grouped[key] = append(grouped[key], r.Role)
+		}
+	}
+	var out []grantRow
+	principal := result.Users[0].User + "@" + result.Users[0].DB
+	for k, roles := range grouped {
+		out = append(out, grantRow{principal: principal, scope: k[0], object: k[1], privileges: roles})
+	}
+	return printGrants(out)
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/config"
+)
+
+var (
+	dbForceSystem bool
+	dbAssumeYes   bool
+)
+
+// Environment variables read by the destructive-command guard (also from .env).
+const (
+	// protectedEnv lists comma-separated database, user and schema names (globs like prod_* allowed) that are never dropped.
+	protectedEnv = "AS_DB_PROTECTED"
+	// assumeYesEnv answers confirmations when stdin is not a terminal, for CI jobs; it is ignored on a terminal.
+	assumeYesEnv = "AS_DB_ASSUME_YES"
+)
+
+// System objects that destructive commands refuse without --force-system.
+var (
+	mysqlSystemDatabases = map[string]bool{"mysql": true, "information_schema": true, "performance_schema": true, "sys": true}
+	mysqlSystemUsers     = map[string]bool{"root": true, "mysql.sys": true, "mysql.session": true, "mysql.infoschema": true, "mariadb.sys": true}
+	pgSystemDatabases    = map[string]bool{"postgres": true, "template0": true, "template1": true}
+	pgSystemUsers        = map[string]bool{"postgres": true}
+	pgSystemSchemas      = map[string]bool{"public": true, "pg_catalog": true, "information_schema": true, "pg_toast": true}
+	mongoSystemDatabases = map[string]bool{"admin": true, "local": true, "config": true}
+	mongoSystemUsers     = map[string]bool{"root": true, "admin": true}
+)
+
+func init() {
+	dbCmd.PersistentFlags().BoolVar(&dbForceSystem, "force-system", false, "allow destructive commands on system databases, users and schemas")
+	dbCmd.PersistentFlags().BoolVarP(&dbAssumeYes, "yes", "y", false, "answer confirmation prompts of destructive commands")
+}
+
+// protectedPattern returns the AS_DB_PROTECTED entry matching name, if any.
+func protectedPattern(name string) (string, bool) {
+	for _, p := range strings.Split(config.GetEnv(protectedEnv, ""), ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+func isProtected(name string) bool {
+	_, ok := protectedPattern(name)
+	return ok
+}
+
+// guardDrop refuses a name listed in AS_DB_PROTECTED outright and a system object unless --force-system is set.
+func guardDrop(kind, name string, system bool) error {
+	if p, ok := protectedPattern(name); ok {
+		return fmt.Errorf("%s '%s' is protected (%s entry %q)", kind, name, protectedEnv, p)
+	}
+	if system && !dbForceSystem {
+		return fmt.Errorf("%s '%s' is a system %s; pass --force-system to continue anyway", kind, name, kind)
+	}
+	return nil
+}
+
+func stdinIsTerminal() bool {
+	fi, err := os.Stdin.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// assumeYes reports whether confirmations are answered without reading stdin:
+// --yes always, AS_DB_ASSUME_YES only when nobody is at a terminal to ask.
+func assumeYes() bool {
+	if dbAssumeYes {
+		return true
+	}
+	if stdinIsTerminal() {
+		return false
+	}
+	switch strings.ToLower(config.GetEnv(assumeYesEnv, "")) {
+	case "1", "true", "yes":
+		return true
+	}
+	return false
+}
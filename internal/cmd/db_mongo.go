@@ -11,6 +11,8 @@ import (
 
 	"github.com/sichang824/awesome-shell/internal/config"
 	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
 	"github.com/spf13/cobra"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -40,20 +42,21 @@ func getMongoConfig() db.MongoConfig {
 	user := os.Getenv("MONGO_INITDB_ROOT_USERNAME")
 	pw := os.Getenv("MONGO_INITDB_ROOT_PASSWORD")
 	config.LoadEnv()
+	cs := composeDefaults(mongoCmd, "mongo", "MONGO_HOST", "MONGO_PORT")
 	if host == "" {
-		host = config.GetEnv("MONGO_HOST", mongoHost)
+		host = config.GetEnv("MONGO_HOST", flagOr(mongoCmd, "host", cs.Host))
 	}
 	if host == "" {
 		host = "127.0.0.1"
 	}
 	if port == "" {
-		port = config.GetEnv("MONGO_PORT", mongoPort)
+		port = config.GetEnv("MONGO_PORT", flagOr(mongoCmd, "port", cs.Port))
 	}
 	if port == "" {
 		port = "27017"
 	}
 	if user == "" {
-		user = mongoUser
+		user = flagOr(mongoCmd, "user", cs.User)
 	}
 	if user == "" {
 		user = config.GetEnv("MONGO_INITDB_ROOT_USERNAME", "root")
@@ -62,7 +65,7 @@ func getMongoConfig() db.MongoConfig {
 		pw = mongoPassword
 	}
 	if pw == "" {
-		pw = config.GetEnv("MONGO_INITDB_ROOT_PASSWORD", "")
+		pw = config.GetEnv("MONGO_INITDB_ROOT_PASSWORD", cs.Password)
 	}
 	return db.MongoConfig{
 		Host:     host,
@@ -73,7 +76,21 @@ func getMongoConfig() db.MongoConfig {
 }
 
 func openMongo(ctx context.Context, cfg db.MongoConfig) (*mongo.Client, error) {
+	if dbViaCompose != "" {
+		return nil, errMongoViaCompose
+	}
 	clientOpts := options.Client().ApplyURI(cfg.URI())
+	if t, err := sshTunnel(); err != nil {
+		return nil, err
+	} else if t != nil {
+		clientOpts.SetDialer(t)
+	}
+	if dbConnectTimeout > 0 {
+		clientOpts.SetConnectTimeout(dbConnectTimeout).SetServerSelectionTimeout(dbConnectTimeout)
+	}
+	if dbStatementTimeout > 0 {
+		clientOpts.SetTimeout(dbStatementTimeout)
+	}
 	client, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
 		return nil, err
@@ -85,6 +102,55 @@ func openMongo(ctx context.Context, cfg db.MongoConfig) (*mongo.Client, error) {
 	return client, nil
 }
 
+// mongoServer runs the commands of the create, delete, grant and list subcommands: through the driver,
+// or with mongosh in the service under --via-compose.
+type mongoServer interface {
+	// RunCommand runs cmd on database and decodes the reply into result unless it is nil.
+	RunCommand(ctx context.Context, database string, cmd bson.D, result any) error
+	// Each runs cmd, which opens a cursor, and calls fn with every document of it.
+	Each(ctx context.Context, database string, cmd bson.D, fn func(bson.Raw) error) error
+	Disconnect(ctx context.Context) error
+}
+
+// mongoDriver is a mongoServer on a driver connection.
+type mongoDriver struct {
+	*mongo.Client
+}
+
+func (c mongoDriver) RunCommand(ctx context.Context, database string, cmd bson.D, result any) error {
+	r := c.Database(database).RunCommand(ctx, cmd)
+	if result == nil {
+		return r.Err()
+	}
+	return r.Decode(result)
+}
+
+func (c mongoDriver) Each(ctx context.Context, database string, cmd bson.D, fn func(bson.Raw) error) error {
+	cursor, err := c.Database(database).RunCommandCursor(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		if err := fn(cursor.Current); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// openMongoServer connects with the driver, or returns the mongosh runner under --via-compose.
+func openMongoServer(ctx context.Context, cfg db.MongoConfig) (mongoServer, error) {
+	if dbViaCompose != "" {
+		return composeMongo(cfg.User, cfg.Password), nil
+	}
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return mongoDriver{client}, nil
+}
+
 var (
 	mongoCreateDBCmd = &cobra.Command{
 		Use:   "create-db [database]",
@@ -112,8 +178,8 @@ var (
 	}
 	mongoGrantCmd = &cobra.Command{
 		Use:   "grant [username] [role] [database]",
-		Short: "Grant role on database to user",
-		Args:  cobra.ExactArgs(3),
+		Short: "Grant role on database to user (or [username] [database] --preset)",
+		Args:  cobra.RangeArgs(2, 3),
 		RunE:  runMongoGrant,
 	}
 	mongoDbsCmd = &cobra.Command{
@@ -147,9 +213,20 @@ var (
 	}
 )
 
-func mongoDBExists(ctx context.Context, client *mongo.Client, name string) (bool, error) {
-	list, err := client.ListDatabases(ctx, bson.M{"name": name})
-	if err != nil {
+// mongoDatabaseList is the reply of listDatabases with nameOnly.
+type mongoDatabaseList struct {
+	Databases []struct {
+		Name string `bson:"name"`
+	} `bson:"databases"`
+}
+
+func mongoDBExists(ctx context.Context, server mongoServer, name string) (bool, error) {
+	var list mongoDatabaseList
+	if err := server.RunCommand(ctx, "admin", bson.D{
+		{Key: "listDatabases", Value: 1},
+		{Key: "filter", Value: bson.D{{Key: "name", Value: name}}},
+		{Key: "nameOnly", Value: true},
+	}, &list); err != nil {
 		return false, err
 	}
 	for _, d := range list.Databases {
@@ -160,34 +237,78 @@ func mongoDBExists(ctx context.Context, client *mongo.Client, name string) (bool
 	return false, nil
 }
 
+func mongoUserExists(ctx context.Context, server mongoServer, username string) (bool, error) {
+	var u bson.M
+	err := server.RunCommand(ctx, "admin", bson.D{{Key: "usersInfo", Value: username}}, &u)
+	if err != nil {
+		return false, err
+	}
+	users, ok := u["users"].(bson.A)
+	return ok && len(users) > 0, nil
+}
+
+// runMongoCommand runs a command that changes the server, or only prints it under --dry-run.
+func runMongoCommand(ctx context.Context, server mongoServer, database string, doc bson.D) error {
+	if exec.DryRun {
+		js, err := bson.MarshalExtJSON(doc, false, false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("[dry-run] db.getSiblingDB(%q).runCommand(%s)\n", database, js)
+		return nil
+	}
+	return server.RunCommand(ctx, database, doc, nil)
+}
+
+func mongoCreateDatabase(ctx context.Context, server mongoServer, name string) error {
+	// Create DB by creating a collection and inserting one doc
+	if err := runMongoCommand(ctx, server, name, bson.D{{Key: "create", Value: "init_collection"}}); err != nil {
+		return err
+	}
+	return runMongoCommand(ctx, server, name, bson.D{
+		{Key: "insert", Value: "init_collection"},
+		{Key: "documents", Value: bson.A{bson.M{"initialized": true}}},
+	})
+}
+
+func mongoCreateUser(ctx context.Context, server mongoServer, username, pw string, roles bson.A) error {
+	cmdDoc := bson.D{
+		{Key: "createUser", Value: username},
+		{Key: "pwd", Value: pw},
+		{Key: "roles", Value: roles},
+	}
+	return runMongoCommand(ctx, server, "admin", cmdDoc)
+}
+
+func mongoGrantRoles(ctx context.Context, server mongoServer, username string, roles bson.A) error {
+	cmdDoc := bson.D{
+		{Key: "grantRolesToUser", Value: username},
+		{Key: "roles", Value: roles},
+	}
+	return runMongoCommand(ctx, server, "admin", cmdDoc)
+}
+
 func runMongoCreateDB(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[0], "database"); err != nil {
 		return err
 	}
 	database := args[0]
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	defer server.Disconnect(ctx)
 
-	exists, err := mongoDBExists(ctx, client, database)
+	exists, err := mongoDBExists(ctx, server, database)
 	if err != nil {
 		return err
 	}
 	if exists {
-		fmt.Println("Database '" + database + "' already exists.")
-		return nil
+		return noop("Database '" + database + "' already exists.")
 	}
-	// Create DB by creating a collection and inserting one doc
-	err = client.Database(database).CreateCollection(ctx, "init_collection")
-	if err != nil {
-		return err
-	}
-	_, err = client.Database(database).Collection("init_collection").InsertOne(ctx, bson.M{"initialized": true})
-	if err != nil {
+	if err := mongoCreateDatabase(ctx, server, database); err != nil {
 		return err
 	}
 	fmt.Println("Database '" + database + "' created.")
@@ -206,30 +327,20 @@ func runMongoCreateUser(cmd *cobra.Command, args []string) error {
 		role = args[1]
 	}
 	pw := genPassword()
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
-
-	admin := client.Database("admin")
-	var u bson.M
-	err = admin.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: username}}).Decode(&u)
-	if err == nil {
-		if users, ok := u["users"].(bson.A); ok && len(users) > 0 {
-			fmt.Println("User '" + username + "' already exists.")
-			return nil
-		}
-	}
+	defer server.Disconnect(ctx)
 
-	cmdDoc := bson.D{
-		{Key: "createUser", Value: username},
-		{Key: "pwd", Value: pw},
-		{Key: "roles", Value: bson.A{bson.D{{Key: "role", Value: role}, {Key: "db", Value: database}}}},
+	exists, err := mongoUserExists(ctx, server, username)
+	if err == nil && exists {
+		return noop("User '" + username + "' already exists.")
 	}
-	if err := admin.RunCommand(ctx, cmdDoc).Err(); err != nil {
+	roles := bson.A{bson.D{{Key: "role", Value: role}, {Key: "db", Value: database}}}
+	if err := mongoCreateUser(ctx, server, username, pw, roles); err != nil {
 		return err
 	}
 	fmt.Println("User:", username)
@@ -243,23 +354,42 @@ func runMongoDeleteDB(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	database := args[0]
-	ctx := context.Background()
+	if err := guardDrop("database", database, mongoSystemDatabases[database]); err != nil {
+		return err
+	}
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	defer server.Disconnect(ctx)
 
-	exists, err := mongoDBExists(ctx, client, database)
+	exists, err := mongoDBExists(ctx, server, database)
 	if err != nil {
 		return err
 	}
 	if !exists {
-		fmt.Println("Database '" + database + "' does not exist.")
-		return nil
+		return noop("Database '" + database + "' does not exist.")
+	}
+	if !confirm("Type database name to confirm: ", database) {
+		return cancelled()
+	}
+	if !dbNoBackup {
+		file := mongoDumpFile
+		if dbViaCompose != "" {
+			file = mongoArchiveFile
+		}
+		if err := backupToTrash("mongo", database, file, func(e *trash.Entry) error {
+			if dbViaCompose != "" {
+				return dumpComposeMongo(cfg.User, cfg.Password, database, e)
+			}
+			return dumpMongoDatabase(ctx, server.(mongoDriver).Client, database, e)
+		}); err != nil {
+			return err
+		}
 	}
-	if err := client.Database(database).Drop(ctx); err != nil {
+	if err := runMongoCommand(ctx, server, database, bson.D{{Key: "dropDatabase", Value: 1}}); err != nil {
 		return err
 	}
 	fmt.Println("Database deleted.")
@@ -271,26 +401,28 @@ func runMongoDeleteUser(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	username := args[0]
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	if err := guardDrop("user", username, mongoSystemUsers[username] || username == cfg.User); err != nil {
+		return err
+	}
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	defer server.Disconnect(ctx)
 
-	admin := client.Database("admin")
-	var u bson.M
-	err = admin.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: username}}).Decode(&u)
+	exists, err := mongoUserExists(ctx, server, username)
 	if err != nil {
 		return err
 	}
-	if users, ok := u["users"].(bson.A); !ok || len(users) == 0 {
-		fmt.Println("User '" + username + "' does not exist.")
-		return nil
+	if !exists {
+		return noop("User '" + username + "' does not exist.")
 	}
-
-	if err := admin.RunCommand(ctx, bson.D{{Key: "dropUser", Value: username}}).Err(); err != nil {
+	if !confirm("Type username to confirm: ", username) {
+		return cancelled()
+	}
+	if err := runMongoCommand(ctx, server, "admin", bson.D{{Key: "dropUser", Value: username}}); err != nil {
 		return err
 	}
 	fmt.Println("User deleted.")
@@ -298,27 +430,19 @@ func runMongoDeleteUser(cmd *cobra.Command, args []string) error {
 }
 
 func runMongoGrant(cmd *cobra.Command, args []string) error {
-	if err := requireSafeIdent(args[0], "username"); err != nil {
-		return err
-	}
-	if err := requireSafeIdent(args[2], "database"); err != nil {
+	username, roles, _, err := mongoRoleArgs(args, mongoGrantPreset)
+	if err != nil {
 		return err
 	}
-	username, role, database := args[0], args[1], args[2]
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
+	defer server.Disconnect(ctx)
 
-	admin := client.Database("admin")
-	cmdDoc := bson.D{
-		{Key: "grantRolesToUser", Value: username},
-		{Key: "roles", Value: bson.A{bson.D{{Key: "role", Value: role}, {Key: "db", Value: database}}}},
-	}
-	if err := admin.RunCommand(ctx, cmdDoc).Err(); err != nil {
+	if err := mongoGrantRoles(ctx, server, username, roles); err != nil {
 		return err
 	}
 	fmt.Println("Granted.")
@@ -326,15 +450,15 @@ func runMongoGrant(cmd *cobra.Command, args []string) error {
 }
 
 func runMongoDbs(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
-	list, err := client.ListDatabases(ctx, bson.M{})
-	if err != nil {
+	defer server.Disconnect(ctx)
+	var list mongoDatabaseList
+	if err := server.RunCommand(ctx, "admin", bson.D{{Key: "listDatabases", Value: 1}, {Key: "nameOnly", Value: true}}, &list); err != nil {
 		return err
 	}
 	for _, d := range list.Databases {
@@ -344,20 +468,19 @@ func runMongoDbs(cmd *cobra.Command, args []string) error {
 }
 
 func runMongoUsers(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
-	admin := client.Database("admin")
+	defer server.Disconnect(ctx)
 	var result struct {
 		Users []struct {
 			User string `bson:"user"`
 		} `bson:"users"`
 	}
-	if err := admin.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: 1}}).Decode(&result); err != nil {
+	if err := server.RunCommand(ctx, "admin", bson.D{{Key: "usersInfo", Value: 1}}, &result); err != nil {
 		return err
 	}
 	for _, u := range result.Users {
@@ -371,41 +494,38 @@ func runMongoCollections(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	database := args[0]
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
-	client, err := openMongo(ctx, cfg)
+	server, err := openMongoServer(ctx, cfg)
 	if err != nil {
 		return err
 	}
-	defer client.Disconnect(ctx)
-	cursor, err := client.Database(database).ListCollections(ctx, bson.M{})
-	if err != nil {
-		return err
-	}
-	defer cursor.Close(ctx)
-	for cursor.Next(ctx) {
-		var doc struct {
-			Name string `bson:"name"`
-		}
-		if err := cursor.Decode(&doc); err != nil {
-			return err
-		}
-		fmt.Println(doc.Name)
-	}
-	return cursor.Err()
+	defer server.Disconnect(ctx)
+	return server.Each(ctx, database, bson.D{{Key: "listCollections", Value: 1}, {Key: "nameOnly", Value: true}}, func(doc bson.Raw) error {
+		name, _ := doc.Lookup("name").StringValueOK()
+		fmt.Println(name)
+		return nil
+	})
 }
 
-func runMongoREPL(ctx context.Context, client *mongo.Client) error {
+func runMongoREPL(parent context.Context, client *mongo.Client) error {
 	scanner := bufio.NewScanner(os.Stdin)
 	var currentDB string
-	fmt.Fprintln(os.Stderr, "Go driver REPL (use <db>, show dbs, show collections, find <coll> [limit], \\q to quit)")
+	fmt.Fprintln(os.Stderr, "Go driver REPL (use <db>, show dbs, show collections, find <coll> [limit], \\q to quit, Ctrl-C cancels the running command)")
+	// stop ends the previous command's context, so Ctrl-C cancels only the command being run.
+	stop := func() {}
+	defer func() { stop() }()
 	for {
+		stop()
+		if parent.Err() != nil {
+			return parent.Err()
+		}
 		if currentDB != "" {
 			fmt.Fprintf(os.Stderr, "mongo:%s> ", currentDB)
 		} else {
 			fmt.Fprint(os.Stderr, "mongo> ")
 		}
-		if !scanner.Scan() {
+		if !scanREPLLine(scanner) {
 			break
 		}
 		line := strings.TrimSpace(scanner.Text())
@@ -415,6 +535,12 @@ func runMongoREPL(ctx context.Context, client *mongo.Client) error {
 		if line == "\\q" || strings.EqualFold(line, "quit") || strings.EqualFold(line, "exit") {
 			break
 		}
+		ctx, cancel := context.WithCancel(parent)
+		restore := onInterrupt(cancel)
+		stop = func() {
+			restore()
+			cancel()
+		}
 		parts := strings.Fields(line)
 		cmd := strings.ToLower(parts[0])
 		switch cmd {
@@ -503,8 +629,11 @@ func runMongoREPL(ctx context.Context, client *mongo.Client) error {
 }
 
 func runMongoClient(cmd *cobra.Command, args []string) error {
-	ctx := context.Background()
+	ctx := dbCtx
 	cfg := getMongoConfig()
+	if dbViaCompose != "" {
+		return runComposeClient("mongo", cfg.User, cfg.Password, "")
+	}
 	client, err := openMongo(ctx, cfg)
 	if err != nil {
 		return err
@@ -524,7 +653,10 @@ func runMongoLogin(cmd *cobra.Command, args []string) error {
 	if cfg.User == "" {
 		return fmt.Errorf("username required: pass [username] [password] or use --user and --password (or set MONGO_INITDB_ROOT_USERNAME / MONGO_INITDB_ROOT_PASSWORD)")
 	}
-	ctx := context.Background()
+	if dbViaCompose != "" {
+		return runComposeClient("mongo", cfg.User, cfg.Password, "")
+	}
+	ctx := dbCtx
 	client, err := openMongo(ctx, cfg)
 	if err != nil {
 		return err
@@ -0,0 +1,228 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/trash"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoDumpFile is the gzip-compressed canonical Extended JSON lines of a MongoDB backup.
+const mongoDumpFile = "dump.jsonl.gz"
+
+// mongoArchiveFile is the mongodump --archive --gzip of a MongoDB backup taken through --via-compose.
+const mongoArchiveFile = "dump.archive.gz"
+
+// mongoInsertBatch is the number of documents per insert during a restore.
+const mongoInsertBatch = 1000
+
+// mongoDumpLine is one line of a dump: a collection header (Document empty) followed by its documents.
+type mongoDumpLine struct {
+	Collection string   `bson:"collection"`
+	Type       string   `bson:"type,omitempty"`
+	Options    bson.D   `bson:"options,omitempty"`
+	Indexes    []bson.D `bson:"indexes,omitempty"`
+	Document   bson.Raw `bson:"document,omitempty"`
+}
+
+func writeMongoDumpLine(w *bufio.Writer, line mongoDumpLine) error {
+	b, err := bson.MarshalExtJSON(line, true, false)
+	if err != nil {
+		return err
+	}
+	w.Write(b)
+	return w.WriteByte('\n')
+}
+
+// mongoCollectionSpec is a listCollections entry.
+type mongoCollectionSpec struct {
+	Name    string `bson:"name"`
+	Type    string `bson:"type"`
+	Options bson.D `bson:"options"`
+}
+
+// listMongoCollections returns the collections and views of d, without system collections.
+func listMongoCollections(ctx context.Context, d *mongo.Database) ([]mongoCollectionSpec, error) {
+	cursor, err := d.ListCollections(ctx, bson.D{})
+	if err != nil {
+		return nil, err
+	}
+	var all, specs []mongoCollectionSpec
+	if err := cursor.All(ctx, &all); err != nil {
+		return nil, err
+	}
+	for _, s := range all {
+		if !strings.HasPrefix(s.Name, "system.") {
+			specs = append(specs, s)
+		}
+	}
+	return specs, nil
+}
+
+// dumpMongoDatabase writes every collection and view of database with its options, indexes and documents.
+func dumpMongoDatabase(ctx context.Context, client *mongo.Client, database string, e *trash.Entry) error {
+	d := client.Database(database)
+	colls, err := listMongoCollections(ctx, d)
+	if err != nil {
+		return err
+	}
+	var specs []mongoDumpLine
+	for _, c := range colls {
+		specs = append(specs, mongoDumpLine{Collection: c.Name, Type: c.Type, Options: c.Options})
+	}
+
+	f, err := os.OpenFile(e.Path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriter(zw)
+	for _, spec := range specs {
+		coll := d.Collection(spec.Collection)
+		if spec.Type != "view" {
+			indexes, err := listMongoIndexes(ctx, coll)
+			if err != nil {
+				return fmt.Errorf("%s: %w", spec.Collection, err)
+			}
+			for _, idx := range indexes {
+				if name, _ := docValue(idx, "name"); name != "_id_" {
+					spec.Indexes = append(spec.Indexes, idx)
+				}
+			}
+		}
+		if err := writeMongoDumpLine(w, spec); err != nil {
+			return err
+		}
+		if spec.Type == "view" {
+			continue
+		}
+		docs, err := coll.Find(ctx, bson.D{})
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.Collection, err)
+		}
+		for docs.Next(ctx) {
+			if err := writeMongoDumpLine(w, mongoDumpLine{Collection: spec.Collection, Document: docs.Current}); err != nil {
+				docs.Close(ctx)
+				return err
+			}
+		}
+		docs.Close(ctx)
+		if err := docs.Err(); err != nil {
+			return fmt.Errorf("%s: %w", spec.Collection, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// restoreMongoTrash recreates the collections of e in database name, loads their documents,
+// then builds the indexes and finally the views.
+func restoreMongoTrash(e trash.Entry, name string) error {
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	if e.File == mongoArchiveFile || dbViaCompose != "" {
+		return restoreComposeMongo(e, cfg.User, cfg.Password, name)
+	}
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	server := mongoDriver{client}
+	exists, err := mongoDBExists(ctx, server, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("database '%s' already exists; pick another name with --as", name)
+	}
+	f, err := os.Open(e.Path())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	d := client.Database(name)
+	var headers, views []mongoDumpLine
+	var batch []interface{}
+	var current string
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		_, err := d.Collection(current).InsertMany(ctx, batch, options.InsertMany().SetBypassDocumentValidation(true))
+		batch = batch[:0]
+		return err
+	}
+	br := bufio.NewReader(zr)
+	for {
+		b, err := br.ReadBytes('\n')
+		if len(b) > 0 {
+			var line mongoDumpLine
+			if err := bson.UnmarshalExtJSON(b, true, &line); err != nil {
+				return err
+			}
+			switch {
+			case line.Document != nil:
+				batch = append(batch, line.Document)
+				if len(batch) >= mongoInsertBatch {
+					if err := flush(); err != nil {
+						return fmt.Errorf("%s: %w", current, err)
+					}
+				}
+			case line.Type == "view":
+				views = append(views, line)
+			default:
+				if err := flush(); err != nil {
+					return fmt.Errorf("%s: %w", current, err)
+				}
+				current = line.Collection
+				create := append(bson.D{{Key: "create", Value: current}}, line.Options...)
+				if err := runMongoCommand(ctx, server, name, create); err != nil {
+					return fmt.Errorf("%s: %w", current, err)
+				}
+				headers = append(headers, line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("%s: %w", current, err)
+	}
+	for _, h := range headers {
+		for _, idx := range h.Indexes {
+			if err := createMongoIndex(ctx, d.Collection(h.Collection), portableIndexSpec(idx)); err != nil {
+				return fmt.Errorf("%s: %w", h.Collection, err)
+			}
+		}
+	}
+	for _, v := range views {
+		if err := runMongoCommand(ctx, server, name, append(bson.D{{Key: "create", Value: v.Collection}}, v.Options...)); err != nil {
+			return fmt.Errorf("%s: %w", v.Collection, err)
+		}
+	}
+	return nil
+}
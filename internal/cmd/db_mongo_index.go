@@ -0,0 +1,724 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	mongoIndexKeys, mongoIndexName, mongoIndexPartial, mongoIndexSpec string
+	mongoIndexUnique, mongoIndexSparse                                bool
+	mongoIndexTTL                                                     int
+	mongoIndexFile                                                    string
+	mongoIndexDropExtra                                               bool
+)
+
+var mongoIndexesCmd = &cobra.Command{
+	Use:   "indexes",
+	Short: "Manage collection indexes (list, create, drop, sync)",
+}
+
+var (
+	mongoIndexesListCmd = &cobra.Command{
+		Use:   "list [database] [collection]",
+		Short: "List indexes with size and usage stats",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runMongoIndexesList,
+	}
+	mongoIndexesCreateCmd = &cobra.Command{
+		Use:   "create [database] [collection]",
+		Short: "Create an index from --keys and option flags, or from a --spec JSON document",
+		Long: `Create an index.
+
+  --keys "a:1,b:-1"          compound index (1 asc, -1 desc; also text, hashed, 2dsphere)
+  --keys "title:text,body:text"  text index
+  --unique --sparse --ttl 3600 --partial '{"status":"active"}'
+  --spec '{"key":{"email":1},"name":"email_1","unique":true}'  createIndexes format`,
+		Args: cobra.ExactArgs(2),
+		RunE: runMongoIndexesCreate,
+	}
+	mongoIndexesDropCmd = &cobra.Command{
+		Use:   "drop [database] [collection] [index]",
+		Short: "Drop an index by name",
+		Args:  cobra.ExactArgs(3),
+		RunE:  runMongoIndexesDrop,
+	}
+	mongoIndexesSyncCmd = &cobra.Command{
+		Use:   "sync [database] [collection]",
+		Short: "Apply a declared index set from a JSON file (idempotent)",
+		Long: `Create missing indexes and recreate changed ones from a JSON file holding
+an array of index specs in createIndexes format (or {"indexes": [...]}).
+With --drop-extra, indexes not in the file are dropped (_id_ is always kept).`,
+		Args: cobra.ExactArgs(2),
+		RunE: runMongoIndexesSync,
+	}
+)
+
+func init() {
+	f := mongoIndexesCreateCmd.Flags()
+	f.StringVar(&mongoIndexKeys, "keys", "", `index keys, e.g. "a:1,b:-1" or "title:text"`)
+	f.StringVar(&mongoIndexName, "name", "", "index name (default generated from keys)")
+	f.BoolVar(&mongoIndexUnique, "unique", false, "unique index")
+	f.BoolVar(&mongoIndexSparse, "sparse", false, "sparse index")
+	f.IntVar(&mongoIndexTTL, "ttl", 0, "TTL in seconds (expireAfterSeconds)")
+	f.StringVar(&mongoIndexPartial, "partial", "", "partial filter expression as JSON")
+	f.StringVar(&mongoIndexSpec, "spec", "", "full index spec as JSON (overrides --keys and option flags)")
+	mongoIndexesSyncCmd.Flags().StringVarP(&mongoIndexFile, "file", "f", "", "JSON file with the declared indexes")
+	mongoIndexesSyncCmd.Flags().BoolVar(&mongoIndexDropExtra, "drop-extra", false, "drop indexes that are not declared")
+	_ = mongoIndexesSyncCmd.MarkFlagRequired("file")
+	mongoIndexesCmd.AddCommand(mongoIndexesListCmd, mongoIndexesCreateCmd, mongoIndexesDropCmd, mongoIndexesSyncCmd)
+	mongoCmd.AddCommand(mongoIndexesCmd)
+}
+
+// parseMongoIndexKeys turns "a:1,b:-1,title:text" into an ordered key document.
+func parseMongoIndexKeys(s string) (bson.D, error) {
+	var keys bson.D
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, dir, ok := strings.Cut(part, ":")
+		if !ok {
+			dir = "1"
+		}
+		field, dir = strings.TrimSpace(field), strings.TrimSpace(dir)
+		if field == "" {
+			return nil, fmt.Errorf("invalid index key %q", part)
+		}
+		if n, err := strconv.Atoi(dir); err == nil {
+			if n != 1 && n != -1 {
+				return nil, fmt.Errorf("invalid direction %q for %s (use 1 or -1)", dir, field)
+			}
+			keys = append(keys, bson.E{Key: field, Value: int32(n)})
+			continue
+		}
+		switch dir {
+		case "text", "hashed", "2dsphere", "2d":
+			keys = append(keys, bson.E{Key: field, Value: dir})
+		default:
+			return nil, fmt.Errorf("invalid index type %q for %s", dir, field)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no index keys given")
+	}
+	return keys, nil
+}
+
+// mongoIndexDefaultName mirrors the server's generated names, e.g. a_1_b_-1.
+func mongoIndexDefaultName(keys bson.D) string {
+	parts := make([]string, 0, len(keys)*2)
+	for _, k := range keys {
+		parts = append(parts, k.Key, fmt.Sprint(k.Value))
+	}
+	return strings.Join(parts, "_")
+}
+
+func docValue(d bson.D, key string) (interface{}, bool) {
+	for _, e := range d {
+		if e.Key == key {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// completeIndexSpec checks a spec has a key document and fills in a default name.
+func completeIndexSpec(spec bson.D) (bson.D, error) {
+	k, ok := docValue(spec, "key")
+	if !ok {
+		return nil, fmt.Errorf("index spec has no \"key\" document")
+	}
+	keys, ok := k.(bson.D)
+	if !ok || len(keys) == 0 {
+		return nil, fmt.Errorf("index spec \"key\" must be a non-empty document")
+	}
+	if _, ok := docValue(spec, "name"); !ok {
+		spec = append(bson.D{{Key: "name", Value: mongoIndexDefaultName(keys)}}, spec...)
+	}
+	return spec, nil
+}
+
+func mongoIndexSpecFromFlags() (bson.D, error) {
+	if mongoIndexSpec != "" {
+		var spec bson.D
+		if err := bson.UnmarshalExtJSON([]byte(mongoIndexSpec), false, &spec); err != nil {
+			return nil, fmt.Errorf("invalid --spec: %w", err)
+		}
+		return completeIndexSpec(spec)
+	}
+	if mongoIndexKeys == "" {
+		return nil, fmt.Errorf("--keys or --spec is required")
+	}
+	keys, err := parseMongoIndexKeys(mongoIndexKeys)
+	if err != nil {
+		return nil, err
+	}
+	name := mongoIndexName
+	if name == "" {
+		name = mongoIndexDefaultName(keys)
+	}
+	spec := bson.D{{Key: "key", Value: keys}, {Key: "name", Value: name}}
+	if mongoIndexUnique {
+		spec = append(spec, bson.E{Key: "unique", Value: true})
+	}
+	if mongoIndexSparse {
+		spec = append(spec, bson.E{Key: "sparse", Value: true})
+	}
+	if mongoIndexTTL > 0 {
+		spec = append(spec, bson.E{Key: "expireAfterSeconds", Value: int32(mongoIndexTTL)})
+	}
+	if mongoIndexPartial != "" {
+		var filter bson.D
+		if err := bson.UnmarshalExtJSON([]byte(mongoIndexPartial), false, &filter); err != nil {
+			return nil, fmt.Errorf("invalid --partial: %w", err)
+		}
+		spec = append(spec, bson.E{Key: "partialFilterExpression", Value: filter})
+	}
+	return spec, nil
+}
+
+func listMongoIndexes(ctx context.Context, coll *mongo.Collection) ([]bson.D, error) {
+	cursor, err := coll.Indexes().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var specs []bson.D
+	if err := cursor.All(ctx, &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+func createMongoIndex(ctx context.Context, coll *mongo.Collection, spec bson.D) error {
+	return runMongoCommand(ctx, mongoDriver{coll.Database().Client()}, coll.Database().Name(), bson.D{
+		{Key: "createIndexes", Value: coll.Name()},
+		{Key: "indexes", Value: bson.A{spec}},
+	})
+}
+
+// portableIndexSpec drops the namespace that older servers add to listIndexes output, so the spec can be created elsewhere.
+func portableIndexSpec(spec bson.D) bson.D {
+	out := bson.D{}
+	for _, e := range spec {
+		if e.Key != "ns" {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func dropMongoIndex(ctx context.Context, coll *mongo.Collection, name string) error {
+	return runMongoCommand(ctx, mongoDriver{coll.Database().Client()}, coll.Database().Name(), bson.D{
+		{Key: "dropIndexes", Value: coll.Name()},
+		{Key: "index", Value: name},
+	})
+}
+
+// mongoIndexOptions summarises the non-key options of an index spec.
+func mongoIndexOptions(spec bson.D) string {
+	var opts []string
+	for _, e := range spec {
+		switch e.Key {
+		case "unique", "sparse":
+			if b, _ := e.Value.(bool); b {
+				opts = append(opts, e.Key)
+			}
+		case "expireAfterSeconds":
+			opts = append(opts, fmt.Sprintf("ttl=%vs", e.Value))
+		case "partialFilterExpression":
+			raw, _ := bson.MarshalExtJSON(e.Value, false, false)
+			opts = append(opts, "partial="+string(raw))
+		case "weights":
+			opts = append(opts, "text")
+		}
+	}
+	if len(opts) == 0 {
+		return "-"
+	}
+	return strings.Join(opts, ",")
+}
+
+func runMongoIndexesList(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	database, collName := args[0], args[1]
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	coll := client.Database(database).Collection(collName)
+
+	specs, err := listMongoIndexes(ctx, coll)
+	if err != nil {
+		return err
+	}
+
+	sizes := map[string]int64{}
+	var stats []struct {
+		StorageStats struct {
+			IndexSizes map[string]int64 `bson:"indexSizes"`
+		} `bson:"storageStats"`
+	}
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}}})
+	if err == nil && cursor.All(ctx, &stats) == nil && len(stats) > 0 {
+		sizes = stats[0].StorageStats.IndexSizes
+	}
+
+	type usage struct {
+		ops   int64
+		since time.Time
+	}
+	usages := map[string]usage{}
+	var idxStats []struct {
+		Name     string `bson:"name"`
+		Accesses struct {
+			Ops   int64     `bson:"ops"`
+			Since time.Time `bson:"since"`
+		} `bson:"accesses"`
+	}
+	cursor, err = coll.Aggregate(ctx, mongo.Pipeline{{{Key: "$indexStats", Value: bson.D{}}}})
+	if err == nil && cursor.All(ctx, &idxStats) == nil {
+		for _, s := range idxStats {
+			usages[s.Name] = usage{ops: s.Accesses.Ops, since: s.Accesses.Since}
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKEYS\tOPTIONS\tSIZE\tOPS\tSINCE")
+	for _, spec := range specs {
+		name, _ := docValue(spec, "name")
+		keys, _ := docValue(spec, "key")
+		rawKeys, _ := bson.MarshalExtJSON(keys, false, false)
+		n := fmt.Sprint(name)
+		u, ok := usages[n]
+		ops, since := "-", "-"
+		if ok {
+			ops = strconv.FormatInt(u.ops, 10)
+			since = u.since.Local().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", n, rawKeys, mongoIndexOptions(spec), humanBytes(sizes[n]), ops, since)
+	}
+	return w.Flush()
+}
+
+func runMongoIndexesCreate(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	database, collName := args[0], args[1]
+	spec, err := mongoIndexSpecFromFlags()
+	if err != nil {
+		return err
+	}
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	if err := createMongoIndex(ctx, client.Database(database).Collection(collName), spec); err != nil {
+		return err
+	}
+	name, _ := docValue(spec, "name")
+	fmt.Printf("Index '%v' created.\n", name)
+	return nil
+}
+
+func runMongoIndexesDrop(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	database, collName, name := args[0], args[1], args[2]
+	if name == "_id_" {
+		return fmt.Errorf("the _id_ index cannot be dropped")
+	}
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	if !confirm("Type index name to confirm: ", name) {
+		return cancelled()
+	}
+	if err := dropMongoIndex(ctx, client.Database(database).Collection(collName), name); err != nil {
+		return err
+	}
+	fmt.Println("Index '" + name + "' dropped.")
+	return nil
+}
+
+// readMongoIndexFile reads a JSON array of index specs, or a document with an "indexes" array.
+func readMongoIndexFile(path string) ([]bson.D, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		trimmed = `{"indexes":` + trimmed + `}`
+	}
+	var doc struct {
+		Indexes []bson.D `bson:"indexes"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(trimmed), false, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	specs := make([]bson.D, 0, len(doc.Indexes))
+	seen := map[string]bool{}
+	for _, s := range doc.Indexes {
+		s, err := completeIndexSpec(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		name, _ := docValue(s, "name")
+		n := fmt.Sprint(name)
+		if seen[n] {
+			return nil, fmt.Errorf("%s: duplicate index name %q", path, n)
+		}
+		seen[n] = true
+		specs = append(specs, s)
+	}
+	return specs, nil
+}
+
+// comparedIndexFields are the spec fields that decide whether an index must be recreated.
+var comparedIndexFields = []string{"key", "unique", "sparse", "expireAfterSeconds", "partialFilterExpression"}
+
+// mongoIndexEqual reports whether the live index have matches the declared spec want.
+func mongoIndexEqual(have, want bson.D) bool {
+	for _, f := range comparedIndexFields {
+		va, _ := docValue(have, f)
+		vb, _ := docValue(want, f)
+		switch f {
+		case "unique", "sparse":
+			ba, _ := va.(bool)
+			bb, _ := vb.(bool)
+			if ba != bb {
+				return false
+			}
+			continue
+		case "key":
+			// The server stores the text fields of an index as {_fts: "text", _ftsx: 1}, with the fields in weights.
+			if fields := mongoTextFields(want); len(fields) > 0 {
+				w, _ := docValue(have, "weights")
+				wd, _ := w.(bson.D)
+				got := make([]string, 0, len(wd))
+				for _, e := range wd {
+					got = append(got, e.Key)
+				}
+				sort.Strings(got)
+				if !reflect.DeepEqual(got, fields) {
+					return false
+				}
+				vb = mongoStoredTextKeys(vb)
+			}
+		}
+		if !reflect.DeepEqual(normalizeBSON(va), normalizeBSON(vb)) {
+			return false
+		}
+	}
+	return true
+}
+
+// mongoTextFields returns the sorted fields indexed as "text" in spec.
+func mongoTextFields(spec bson.D) []string {
+	k, _ := docValue(spec, "key")
+	keys, _ := k.(bson.D)
+	var fields []string
+	for _, e := range keys {
+		if e.Value == "text" {
+			fields = append(fields, e.Key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// mongoStoredTextKeys returns a text index's key document as the server stores it: the text fields are
+// replaced, where the first of them stands, by _fts and _ftsx, and the other keys are kept in order.
+func mongoStoredTextKeys(k interface{}) bson.D {
+	keys, _ := k.(bson.D)
+	out := bson.D{}
+	text := false
+	for _, e := range keys {
+		if e.Value != "text" {
+			out = append(out, e)
+		} else if !text {
+			out = append(out, bson.E{Key: "_fts", Value: "text"}, bson.E{Key: "_ftsx", Value: int32(1)})
+			text = true
+		}
+	}
+	return out
+}
+
+// normalizeBSON makes values comparable across int32/int64/double and document types.
+func normalizeBSON(v interface{}) interface{} {
+	switch x := v.(type) {
+	case int32:
+		return float64(x)
+	case int64:
+		return float64(x)
+	case int:
+		return float64(x)
+	case bson.D:
+		out := make([][2]interface{}, len(x))
+		for i, e := range x {
+			out[i] = [2]interface{}{e.Key, normalizeBSON(e.Value)}
+		}
+		return out
+	case bson.M:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make([][2]interface{}, len(keys))
+		for i, k := range keys {
+			out[i] = [2]interface{}{k, normalizeBSON(x[k])}
+		}
+		return out
+	case bson.A:
+		out := make([]interface{}, len(x))
+		for i, e := range x {
+			out[i] = normalizeBSON(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// checkMongoIndexBuild makes sure the declared spec can be built before the live index have is dropped for it.
+// It builds spec under a temporary name and drops that again. The server allows one index per key pattern and
+// one text index per collection, so when have shares spec's keys only a new unique constraint can fail, and
+// existing duplicates are looked for instead.
+func checkMongoIndexBuild(ctx context.Context, coll *mongo.Collection, have, spec bson.D) error {
+	if exec.DryRun {
+		return nil
+	}
+	hk, _ := docValue(have, "key")
+	wk, _ := docValue(spec, "key")
+	_, haveText := docValue(have, "weights")
+	if len(mongoTextFields(spec)) > 0 {
+		wk = mongoStoredTextKeys(wk)
+	}
+	if haveText || reflect.DeepEqual(normalizeBSON(hk), normalizeBSON(wk)) {
+		hu, _ := docValue(have, "unique")
+		wu, _ := docValue(spec, "unique")
+		haveUnique, _ := hu.(bool)
+		if wantUnique, _ := wu.(bool); !wantUnique || haveUnique {
+			return nil
+		}
+		return findMongoDuplicate(ctx, coll, spec)
+	}
+	name, _ := docValue(spec, "name")
+	tmp := fmt.Sprint(name) + "_as_sync"
+	trial := bson.D{}
+	for _, e := range spec {
+		if e.Key == "name" {
+			e.Value = tmp
+		}
+		trial = append(trial, e)
+	}
+	if err := createMongoIndex(ctx, coll, trial); err != nil {
+		return err
+	}
+	return dropMongoIndex(ctx, coll, tmp)
+}
+
+// mongoIndexSameKeys returns the live index not named in wanted that the server would see as spec's keys
+// (the same key pattern, or a second text index), which blocks building spec next to it.
+func mongoIndexSameKeys(current []bson.D, wanted map[string]bool, spec bson.D) (string, bson.D, bool) {
+	wk, _ := docValue(spec, "key")
+	text := len(mongoTextFields(spec)) > 0
+	if text {
+		wk = mongoStoredTextKeys(wk)
+	}
+	for _, have := range current {
+		name, _ := docValue(have, "name")
+		if wanted[fmt.Sprint(name)] {
+			continue
+		}
+		hk, _ := docValue(have, "key")
+		_, haveText := docValue(have, "weights")
+		if (text && haveText) || reflect.DeepEqual(normalizeBSON(hk), normalizeBSON(wk)) {
+			return fmt.Sprint(name), have, true
+		}
+	}
+	return "", nil, false
+}
+
+// findMongoDuplicate returns an error when two documents covered by the unique index spec share its keys.
+func findMongoDuplicate(ctx context.Context, coll *mongo.Collection, spec bson.D) error {
+	k, _ := docValue(spec, "key")
+	group := bson.D{}
+	for i, e := range k.(bson.D) {
+		group = append(group, bson.E{Key: fmt.Sprintf("k%d", i), Value: "$" + e.Key})
+	}
+	var pipeline bson.A
+	if filter, ok := docValue(spec, "partialFilterExpression"); ok {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: filter}})
+	}
+	pipeline = append(pipeline,
+		bson.D{{Key: "$group", Value: bson.D{{Key: "_id", Value: group}, {Key: "n", Value: bson.D{{Key: "$sum", Value: 1}}}}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "n", Value: bson.D{{Key: "$gt", Value: 1}}}}}},
+		bson.D{{Key: "$limit", Value: 1}})
+	cursor, err := coll.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	if cursor.Next(ctx) {
+		return fmt.Errorf("documents with duplicate keys %s prevent a unique index", cursor.Current.Lookup("_id").String())
+	}
+	return cursor.Err()
+}
+
+func runMongoIndexesSync(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	database, collName := args[0], args[1]
+	declared, err := readMongoIndexFile(mongoIndexFile)
+	if err != nil {
+		return err
+	}
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	coll := client.Database(database).Collection(collName)
+
+	current, err := listMongoIndexes(ctx, coll)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bson.D{}
+	for _, spec := range current {
+		name, _ := docValue(spec, "name")
+		existing[fmt.Sprint(name)] = spec
+	}
+
+	wanted := map[string]bool{"_id_": true}
+	for _, spec := range declared {
+		name, _ := docValue(spec, "name")
+		wanted[fmt.Sprint(name)] = true
+	}
+	var extra []string
+	if mongoIndexDropExtra {
+		for _, spec := range current {
+			name, _ := docValue(spec, "name")
+			if n := fmt.Sprint(name); !wanted[n] {
+				extra = append(extra, n)
+			}
+		}
+	}
+	if len(extra) > 0 {
+		fmt.Println("Indexes not in " + mongoIndexFile + " will be dropped: " + strings.Join(extra, ", "))
+		if !confirm("Type collection name to confirm: ", collName) {
+			return cancelled()
+		}
+	}
+
+	// replace drops the live index have (named old) for spec, and builds have again when spec fails.
+	replace := func(old string, have, spec bson.D) error {
+		name, _ := docValue(spec, "name")
+		n := fmt.Sprint(name)
+		if err := checkMongoIndexBuild(ctx, coll, have, spec); err != nil {
+			return fmt.Errorf("index '%s' left unchanged: %w", old, err)
+		}
+		if err := dropMongoIndex(ctx, coll, old); err != nil {
+			return err
+		}
+		if old == n {
+			fmt.Println("Recreating index '" + n + "'")
+		} else {
+			fmt.Println("Replacing index '" + old + "' with '" + n + "'")
+		}
+		if err := createMongoIndex(ctx, coll, spec); err != nil {
+			if restoreErr := createMongoIndex(ctx, coll, portableIndexSpec(have)); restoreErr != nil {
+				return fmt.Errorf("%w; restoring the previous index '%s' also failed: %v", err, old, restoreErr)
+			}
+			return fmt.Errorf("%w (previous index '%s' restored)", err, old)
+		}
+		return nil
+	}
+
+	changed := 0
+	dropped := map[string]bool{}
+	for _, spec := range declared {
+		name, _ := docValue(spec, "name")
+		n := fmt.Sprint(name)
+		have, ok := existing[n]
+		if ok && mongoIndexEqual(have, spec) {
+			continue
+		}
+		if ok {
+			if err := replace(n, have, spec); err != nil {
+				return err
+			}
+			changed++
+			continue
+		}
+		// The server refuses a second index on the same keys, so a renamed index replaces the old one.
+		if old, have, found := mongoIndexSameKeys(current, wanted, spec); found {
+			if !mongoIndexDropExtra {
+				return fmt.Errorf("index '%s' has the same keys as the live index '%s'; sync with --drop-extra to replace it", n, old)
+			}
+			if err := replace(old, have, spec); err != nil {
+				return err
+			}
+			// Gone now: not to be matched by another spec nor dropped with the extras.
+			dropped[old], wanted[old] = true, true
+			changed++
+			continue
+		}
+		fmt.Println("Creating index '" + n + "'")
+		if err := createMongoIndex(ctx, coll, spec); err != nil {
+			return err
+		}
+		changed++
+	}
+	for _, n := range extra {
+		if dropped[n] {
+			continue
+		}
+		if err := dropMongoIndex(ctx, coll, n); err != nil {
+			return err
+		}
+		fmt.Println("Dropped index '" + n + "'")
+		changed++
+	}
+	if changed == 0 {
+		return noop("Indexes already in sync.")
+	}
+	fmt.Printf("%d index change(s) applied.\n", changed)
+	return nil
+}
@@ -0,0 +1,252 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mysqlAccountHost string
+	mysqlAuthPlugin  string
+	mysqlRequireSSL  bool
+	mysqlMaxConns    int
+	mysqlPwExpire    string
+)
+
+// safeAccountHost allows host names, IP addresses, netmasks and the % / _ wildcards of MySQL account hosts.
+var safeAccountHost = regexp.MustCompile(`^[a-zA-Z0-9._%:/-]+$`)
+
+var (
+	mysqlLockUserCmd = &cobra.Command{
+		Use:   "lock-user [username]",
+		Short: "Lock a MySQL account (ACCOUNT LOCK), existing sessions stay open",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlLockUser,
+	}
+	mysqlUnlockUserCmd = &cobra.Command{
+		Use:   "unlock-user [username]",
+		Short: "Unlock a MySQL account (ACCOUNT UNLOCK)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlUnlockUser,
+	}
+)
+
+func init() {
+	mysqlCmd.PersistentFlags().StringVar(&mysqlAccountHost, "account-host", "%", "host part of the account for user commands (e.g. localhost, 10.%)")
+	f := mysqlCreateUserCmd.Flags()
+	f.StringVar(&mysqlAuthPlugin, "auth-plugin", "", "authentication plugin (e.g. caching_sha2_password, mysql_native_password; default server default)")
+	f.BoolVar(&mysqlRequireSSL, "require-ssl", false, "only allow TLS connections (REQUIRE SSL)")
+	f.IntVar(&mysqlMaxConns, "max-connections", 0, "limit simultaneous connections (MAX_USER_CONNECTIONS, 0 = server default)")
+	f.StringVar(&mysqlPwExpire, "password-expire", "", "password expiry: now, never, default or a number of days")
+	mysqlCmd.AddCommand(mysqlLockUserCmd, mysqlUnlockUserCmd)
+}
+
+// mysqlAccountOptions are the CREATE USER options beyond name, host and password.
+type mysqlAccountOptions struct {
+	plugin         string
+	requireSSL     bool
+	maxConnections int
+	passwordExpire string
+}
+
+// mysqlAccount quotes username@host for account statements; both must already be validated.
+func mysqlAccount(username, host string) string {
+	return "`" + username + "`@'" + host + "'"
+}
+
+func requireAccountHost(host string) error {
+	if !safeAccountHost.MatchString(host) {
+		return fmt.Errorf("invalid account host %q (letters, numbers, . _ %% : / - allowed)", host)
+	}
+	return nil
+}
+
+// passwordExpireClause turns --password-expire into its CREATE USER clause.
+func passwordExpireClause(v string) (string, error) {
+	switch v {
+	case "":
+		return "", nil
+	case "now":
+		return " PASSWORD EXPIRE", nil
+	case "never":
+		return " PASSWORD EXPIRE NEVER", nil
+	case "default":
+		return " PASSWORD EXPIRE DEFAULT", nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days <= 0 {
+		return "", fmt.Errorf("invalid --password-expire %q (use now, never, default or a number of days)", v)
+	}
+	return " PASSWORD EXPIRE INTERVAL " + strconv.Itoa(days) + " DAY", nil
+}
+
+func (o mysqlAccountOptions) validate() error {
+	if o.plugin != "" {
+		if err := requireSafeIdent(o.plugin, "auth plugin"); err != nil {
+			return err
+		}
+	}
+	if o.maxConnections < 0 {
+		return fmt.Errorf("invalid --max-connections %d", o.maxConnections)
+	}
+	_, err := passwordExpireClause(o.passwordExpire)
+	return err
+}
+
+func mysqlIsMariaDB(conn *sql.DB) (bool, error) {
+	var version string
+	if err := conn.QueryRowContext(dbCtx, "SELECT VERSION()").Scan(&version); err != nil {
+		return false, err
+	}
+	return strings.Contains(strings.ToLower(version), "mariadb"), nil
+}
+
+// mysqlCreateUserStatement builds CREATE USER with the options in the order MySQL and MariaDB both accept.
+func mysqlCreateUserStatement(conn *sql.DB, username, host, pw string, opts mysqlAccountOptions) (string, error) {
+	// MySQL does not support placeholders for identifiers in CREATE USER
+	pwEsc := strings.ReplaceAll(pw, "'", "''")
+	stmt := "CREATE USER IF NOT EXISTS " + mysqlAccount(username, host)
+	if opts.plugin == "" {
+		stmt += " IDENTIFIED BY '" + pwEsc + "'"
+	} else {
+		maria, err := mysqlIsMariaDB(conn)
+		if err != nil {
+			return "", err
+		}
+		if maria {
+			stmt += " IDENTIFIED VIA " + opts.plugin + " USING PASSWORD('" + pwEsc + "')"
+		} else {
+			stmt += " IDENTIFIED WITH " + opts.plugin + " BY '" + pwEsc + "'"
+		}
+	}
+	if opts.requireSSL {
+		stmt += " REQUIRE SSL"
+	}
+	if opts.maxConnections > 0 {
+		stmt += " WITH MAX_USER_CONNECTIONS " + strconv.Itoa(opts.maxConnections)
+	}
+	expire, err := passwordExpireClause(opts.passwordExpire)
+	if err != nil {
+		return "", err
+	}
+	return stmt + expire, nil
+}
+
+func runMysqlLockUser(cmd *cobra.Command, args []string) error {
+	return setMysqlAccountLock(args[0], true)
+}
+
+func runMysqlUnlockUser(cmd *cobra.Command, args []string) error {
+	return setMysqlAccountLock(args[0], false)
+}
+
+func setMysqlAccountLock(username string, lock bool) error {
+	if err := requireSafeIdent(username, "username"); err != nil {
+		return err
+	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := mysqlUserExists(conn, username, mysqlAccountHost)
+	if err != nil {
+		return err
+	}
+	account := username + "@" + mysqlAccountHost
+	if !exists {
+		return noop("User '" + account + "' does not exist.")
+	}
+	clause, done := " ACCOUNT LOCK", "locked"
+	if !lock {
+		clause, done = " ACCOUNT UNLOCK", "unlocked"
+	}
+	if err := execSQL(conn, "ALTER USER "+mysqlAccount(username, mysqlAccountHost)+clause); err != nil {
+		return err
+	}
+	fmt.Println("User '" + account + "' " + done + ".")
+	return nil
+}
+
+const (
+	mysqlUsersQuery = `SELECT user, host, COALESCE(plugin, ''), ssl_type, max_user_connections, password_expired,
+	password_lifetime, account_locked
+FROM mysql.user ORDER BY user, host`
+	// MariaDB 10.4+ keeps lifetime and lock state only in the JSON of mysql.global_priv.
+	mysqlUsersQueryMariaDB = `SELECT u.user, u.host, COALESCE(u.plugin, ''), u.ssl_type, u.max_user_connections, u.password_expired,
+	JSON_VALUE(g.priv, '$.password_lifetime'), IF(JSON_VALUE(g.priv, '$.account_locked') = 'true', 'Y', 'N')
+FROM mysql.user u JOIN mysql.global_priv g ON g.user = u.user AND g.host = u.host
+WHERE u.is_role = 'N' ORDER BY u.user, u.host`
+)
+
+func runMysqlUsers(cmd *cobra.Command, args []string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(dbCtx, mysqlUsersQuery)
+	if err != nil {
+		var fallbackErr error
+		rows, fallbackErr = conn.QueryContext(dbCtx, mysqlUsersQueryMariaDB)
+		if fallbackErr != nil {
+			return fmt.Errorf("mysql.user: %v; mysql.global_priv: %w", err, fallbackErr)
+		}
+	}
+	defer rows.Close()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ACCOUNT\tPLUGIN\tSSL\tMAX_CONN\tPASSWORD\tLOCKED")
+	for rows.Next() {
+		var user, host, plugin, sslType, expired, locked string
+		var maxConns int64
+		var lifetime sql.NullString
+		if err := rows.Scan(&user, &host, &plugin, &sslType, &maxConns, &expired, &lifetime, &locked); err != nil {
+			return err
+		}
+		if sslType == "" {
+			sslType = "-"
+		}
+		conns := "-"
+		if maxConns > 0 {
+			conns = strconv.FormatInt(maxConns, 10)
+		}
+		fmt.Fprintf(w, "%s@%s\t%s\t%s\t%s\t%s\t%s\n", user, host, plugin, sslType, conns, passwordState(expired, lifetime), yesNo(locked == "Y"))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// passwordState summarises password_expired and password_lifetime (NULL = server default, 0 = never).
+func passwordState(expired string, lifetime sql.NullString) string {
+	switch {
+	case expired == "Y":
+		return "expired"
+	case !lifetime.Valid || lifetime.String == "" || lifetime.String == "-1":
+		return "default"
+	case lifetime.String == "0":
+		return "never expires"
+	}
+	return "expires every " + lifetime.String + "d"
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
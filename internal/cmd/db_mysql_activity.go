@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	mysqlPlWatch           time.Duration
+	mysqlPlUser, mysqlPlDB string
+	mysqlPlCommand         string
+	mysqlPlMinTime         int
+	mysqlPlQueryLen        int
+	mysqlKillQueryOnly     bool
+)
+
+var (
+	mysqlProcesslistCmd = &cobra.Command{
+		Use:   "processlist",
+		Short: "List server threads (user, db, command, time, state, query)",
+		Args:  cobra.NoArgs,
+		RunE:  runMysqlProcesslist,
+	}
+	mysqlLockWaitsCmd = &cobra.Command{
+		Use:   "lock-waits",
+		Short: "Show InnoDB lock waits (waiting and blocking threads)",
+		Long:  "Uses sys.innodb_lock_waits (MySQL 5.7/8) and falls back to information_schema.innodb_lock_waits (MariaDB).",
+		Args:  cobra.NoArgs,
+		RunE:  runMysqlLockWaits,
+	}
+	mysqlKillCmd = &cobra.Command{
+		Use:   "kill [id]",
+		Short: "Kill a connection, or only its running statement with --query-only",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlKill,
+	}
+)
+
+func init() {
+	f := mysqlProcesslistCmd.Flags()
+	f.DurationVar(&mysqlPlWatch, "watch", 0, "refresh every interval (e.g. 2s) until Ctrl-C")
+	f.StringVar(&mysqlPlUser, "filter-user", "", "only threads of this user")
+	f.StringVar(&mysqlPlDB, "db", "", "only threads using this database")
+	f.StringVar(&mysqlPlCommand, "command", "", "only threads in this command state (e.g. Query, Sleep)")
+	f.IntVar(&mysqlPlMinTime, "min-time", 0, "only threads running at least this many seconds")
+	f.IntVar(&mysqlPlQueryLen, "query-width", 80, "truncate queries to this many characters (0 = no limit)")
+	mysqlLockWaitsCmd.Flags().DurationVar(&mysqlPlWatch, "watch", 0, "refresh every interval (e.g. 2s) until Ctrl-C")
+	mysqlLockWaitsCmd.Flags().IntVar(&mysqlPlQueryLen, "query-width", 80, "truncate queries to this many characters (0 = no limit)")
+	mysqlKillCmd.Flags().BoolVar(&mysqlKillQueryOnly, "query-only", false, "terminate only the running statement (KILL QUERY), keep the connection")
+	mysqlCmd.AddCommand(mysqlProcesslistCmd, mysqlLockWaitsCmd, mysqlKillCmd)
+}
+
+func runMysqlProcesslist(cmd *cobra.Command, args []string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	q := `SELECT id, user, host, COALESCE(db, ''), command, time, COALESCE(state, ''), COALESCE(info, '')
+		FROM information_schema.processlist WHERE id <> CONNECTION_ID()`
+	var params []interface{}
+	if mysqlPlUser != "" {
+		q += " AND user = ?"
+		params = append(params, mysqlPlUser)
+	}
+	if mysqlPlDB != "" {
+		q += " AND db = ?"
+		params = append(params, mysqlPlDB)
+	}
+	if mysqlPlCommand != "" {
+		q += " AND command = ?"
+		params = append(params, mysqlPlCommand)
+	}
+	if mysqlPlMinTime > 0 {
+		q += " AND time >= ?"
+		params = append(params, mysqlPlMinTime)
+	}
+	q += " ORDER BY time DESC, id"
+
+	return watchLoop(mysqlPlWatch, func() error {
+		rows, err := conn.QueryContext(dbCtx, q, params...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tUSER\tHOST\tDB\tCOMMAND\tTIME\tSTATE\tQUERY")
+		for rows.Next() {
+			var id, seconds int64
+			var user, host, database, command, state, info string
+			if err := rows.Scan(&id, &user, &host, &database, &command, &seconds, &state, &info); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", id, user, host, database, command,
+				(time.Duration(seconds) * time.Second).String(), state, oneLine(info, mysqlPlQueryLen))
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+}
+
+const (
+	mysqlLockWaitsSys = `SELECT waiting_pid, COALESCE(waiting_query, ''), blocking_pid, COALESCE(blocking_query, ''),
+	COALESCE(locked_table, ''), COALESCE(waiting_lock_mode, ''), wait_age_secs
+FROM sys.innodb_lock_waits ORDER BY wait_age_secs DESC`
+	mysqlLockWaitsInfoSchema = `SELECT r.trx_mysql_thread_id, COALESCE(r.trx_query, ''), b.trx_mysql_thread_id, COALESCE(b.trx_query, ''),
+	COALESCE(rl.lock_table, ''), COALESCE(rl.lock_mode, ''), TIMESTAMPDIFF(SECOND, r.trx_wait_started, NOW())
+FROM information_schema.innodb_lock_waits w
+JOIN information_schema.innodb_trx b ON b.trx_id = w.blocking_trx_id
+JOIN information_schema.innodb_trx r ON r.trx_id = w.requesting_trx_id
+LEFT JOIN information_schema.innodb_locks rl ON rl.lock_id = w.requested_lock_id
+ORDER BY r.trx_wait_started`
+)
+
+func runMysqlLockWaits(cmd *cobra.Command, args []string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return watchLoop(mysqlPlWatch, func() error {
+		rows, err := conn.QueryContext(dbCtx, mysqlLockWaitsSys)
+		if err != nil {
+			// MariaDB ships without the sys schema; its information_schema still has the lock tables.
+			var fallbackErr error
+			rows, fallbackErr = conn.QueryContext(dbCtx, mysqlLockWaitsInfoSchema)
+			if fallbackErr != nil {
+				return fmt.Errorf("sys.innodb_lock_waits: %v; information_schema.innodb_lock_waits: %w", err, fallbackErr)
+			}
+		}
+		defer rows.Close()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "WAITING\tWAITING_QUERY\tBLOCKING\tBLOCKING_QUERY\tTABLE\tMODE\tWAIT")
+		n := 0
+		for rows.Next() {
+			var waitingID, blockingID int64
+			var waitingQuery, blockingQuery, table, mode string
+			var seconds sql.NullFloat64
+			if err := rows.Scan(&waitingID, &waitingQuery, &blockingID, &blockingQuery, &table, &mode, &seconds); err != nil {
+				return err
+			}
+			if blockingQuery == "" {
+				blockingQuery = "(idle in transaction)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\t%s\n", waitingID, oneLine(waitingQuery, mysqlPlQueryLen), blockingID,
+				oneLine(blockingQuery, mysqlPlQueryLen), table, mode, formatSeconds(seconds))
+			n++
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if n == 0 {
+			fmt.Println("No lock waits.")
+			return nil
+		}
+		return w.Flush()
+	})
+}
+
+func runMysqlKill(cmd *cobra.Command, args []string) error {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid thread id %q", args[0])
+	}
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var user, host, command, info string
+	err = conn.QueryRowContext(dbCtx, "SELECT user, host, command, COALESCE(info, '') FROM information_schema.processlist WHERE id = ?", id).
+		Scan(&user, &host, &command, &info)
+	if err == sql.ErrNoRows {
+		return noop(fmt.Sprintf("Thread %d does not exist.", id))
+	}
+	if err != nil {
+		return err
+	}
+	action, stmt := "Kill connection", "KILL CONNECTION "
+	if mysqlKillQueryOnly {
+		action, stmt = "Kill running statement of", "KILL QUERY "
+	}
+	fmt.Printf("%s %d (%s@%s, %s): %s\n", action, id, user, host, command, oneLine(info, 120))
+	if !confirm("Type thread id to confirm: ", args[0]) {
+		return cancelled()
+	}
+	// KILL takes no placeholders; id is a parsed integer.
+	if err := execSQL(conn, stmt+strconv.FormatInt(id, 10)); err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(stmt), id, "sent.")
+	return nil
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/sichang824/awesome-shell/internal/trash"
+)
+
+// mysqlDumpFile is the gzip-compressed SQL script of a MySQL backup; it also loads with the mysql client.
+const mysqlDumpFile = "dump.sql.gz"
+
+// mysqlInsertBatch is the number of rows per INSERT statement in a dump.
+const mysqlInsertBatch = 100
+
+// mysqlBinaryTypes are the column types dumped as hex literals.
+var mysqlBinaryTypes = map[string]bool{
+	"BINARY": true, "VARBINARY": true, "TINYBLOB": true, "BLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"BIT": true, "GEOMETRY": true,
+}
+
+// mysqlDefiner matches the DEFINER clause, dropped so a restore does not need the original account.
+var mysqlDefiner = regexp.MustCompile(`DEFINER=\x60[^\x60]*\x60@\x60[^\x60]*\x60 `)
+
+// mysqlQuote returns s as a single-quoted string literal.
+func mysqlQuote(s string) string {
+	var b strings.Builder
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		case '\'', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// mysqlLiteral formats a scanned value for an INSERT; dump and restore both run in UTC.
+func mysqlLiteral(v any, typeName string) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case uint64:
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case time.Time:
+		if v.IsZero() {
+			return "'0000-00-00 00:00:00'"
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case []byte:
+		if mysqlBinaryTypes[typeName] && len(v) > 0 {
+			return "X'" + hex.EncodeToString(v) + "'"
+		}
+		return mysqlQuote(string(v))
+	case string:
+		return mysqlQuote(v)
+	}
+	return mysqlQuote(fmt.Sprint(v))
+}
+
+// mysqlShowCreate runs a SHOW CREATE statement and returns column col of its single row, "" when it is NULL
+// (the server hides routine bodies from users without privileges on them).
+func mysqlShowCreate(ctx context.Context, c *sql.Conn, query string, col int) (string, error) {
+	rows, err := c.QueryContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		return "", fmt.Errorf("%s: no result", query)
+	}
+	vals := make([]sql.NullString, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	return vals[col].String, rows.Err()
+}
+
+// dumpMySQLDatabase writes tables, rows, views, triggers, routines and events of database to e's dump file
+// from one consistent snapshot.
+func dumpMySQLDatabase(cfg db.MySQLConfig, database string, e *trash.Entry) error {
+	cfg.Database = database
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	ctx := dbCtx
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	var charset, collation string
+	if err := c.QueryRowContext(ctx, "SELECT default_character_set_name, default_collation_name FROM information_schema.schemata WHERE schema_name = ?",
+		database).Scan(&charset, &collation); err != nil {
+		return err
+	}
+	e.Options["charset"], e.Options["collation"] = charset, collation
+	if dbViaCompose != "" {
+		return dumpComposeMySQL(cfg.User, cfg.Password, database, e)
+	}
+	// The dump is written in UTC, as its header says.
+	if _, err := c.ExecContext(ctx, "SET time_zone = '+00:00'"); err != nil {
+		return err
+	}
+	if _, err := c.ExecContext(ctx, "SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ"); err != nil {
+		return err
+	}
+	if _, err := c.ExecContext(ctx, "START TRANSACTION WITH CONSISTENT SNAPSHOT"); err != nil {
+		return err
+	}
+	defer c.ExecContext(ctx, "ROLLBACK")
+
+	f, err := os.OpenFile(e.Path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zw := gzip.NewWriter(f)
+	w := bufio.NewWriter(zw)
+	if err := writeMySQLDump(ctx, c, w, database); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func writeMySQLDump(ctx context.Context, c *sql.Conn, w *bufio.Writer, database string) error {
+	fmt.Fprintf(w, "-- as db backup of `%s`, %s\n", database, time.Now().UTC().Format(time.RFC3339))
+	w.WriteString("SET NAMES utf8mb4;\nSET time_zone = '+00:00';\nSET FOREIGN_KEY_CHECKS = 0;\nSET UNIQUE_CHECKS = 0;\n")
+	w.WriteString("SET SQL_MODE = 'NO_AUTO_VALUE_ON_ZERO';\n")
+
+	var tables, views []string
+	rows, err := c.QueryContext(ctx, "SELECT table_name, table_type FROM information_schema.tables WHERE table_schema = DATABASE() ORDER BY table_name")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			rows.Close()
+			return err
+		}
+		if typ == "VIEW" {
+			views = append(views, name)
+		} else {
+			tables = append(tables, name)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		ddl, err := mysqlShowCreate(ctx, c, "SHOW CREATE TABLE `"+t+"`", 1)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n-- table %s\n%s;\n", t, ddl)
+		if err := writeMySQLRows(ctx, c, w, t); err != nil {
+			return fmt.Errorf("%s: %w", t, err)
+		}
+	}
+	for _, v := range views {
+		ddl, err := mysqlShowCreate(ctx, c, "SHOW CREATE VIEW `"+v+"`", 1)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "\n-- view %s\n%s;\n", v, mysqlDefiner.ReplaceAllString(ddl, ""))
+	}
+
+	// Triggers, routines and events contain ; so they are written with the mysql client's DELIMITER convention.
+	type object struct{ kind, name string }
+	var objects []object
+	rows, err = c.QueryContext(ctx, `SELECT 'TRIGGER', trigger_name FROM information_schema.triggers WHERE trigger_schema = DATABASE()
+UNION ALL SELECT routine_type, routine_name FROM information_schema.routines WHERE routine_schema = DATABASE()
+UNION ALL SELECT 'EVENT', event_name FROM information_schema.events WHERE event_schema = DATABASE()`)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, o := range objects {
+		// The statement is the third column for triggers, procedures and functions, the fourth for events.
+		col := 2
+		if o.kind == "EVENT" {
+			col = 3
+		}
+		ddl, err := mysqlShowCreate(ctx, c, "SHOW CREATE "+o.kind+" `"+o.name+"`", col)
+		if err != nil {
+			return err
+		}
+		if ddl == "" {
+			fmt.Fprintf(os.Stderr, "warning: no privilege to read %s %s, not in the backup\n", strings.ToLower(o.kind), o.name)
+			continue
+		}
+		fmt.Fprintf(w, "\n-- %s %s\nDELIMITER ;;\n%s;;\nDELIMITER ;\n", strings.ToLower(o.kind), o.name, mysqlDefiner.ReplaceAllString(ddl, ""))
+	}
+	_, err = w.WriteString("\nSET FOREIGN_KEY_CHECKS = 1;\nSET UNIQUE_CHECKS = 1;\n")
+	return err
+}
+
+// writeMySQLRows writes the rows of table as batched INSERTs, leaving out generated columns.
+func writeMySQLRows(ctx context.Context, c *sql.Conn, w *bufio.Writer, table string) error {
+	var cols []string
+	crows, err := c.QueryContext(ctx, `SELECT column_name FROM information_schema.columns
+WHERE table_schema = DATABASE() AND table_name = ? AND extra NOT LIKE '%VIRTUAL GENERATED%' AND extra NOT LIKE '%STORED GENERATED%'
+ORDER BY ordinal_position`, table)
+	if err != nil {
+		return err
+	}
+	for crows.Next() {
+		var col string
+		if err := crows.Scan(&col); err != nil {
+			crows.Close()
+			return err
+		}
+		cols = append(cols, col)
+	}
+	crows.Close()
+	if err := crows.Err(); err != nil {
+		return err
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	list := "`" + strings.Join(cols, "`, `") + "`"
+	rows, err := c.QueryContext(ctx, "SELECT "+list+" FROM `"+table+"`")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	n := 0
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		if n%mysqlInsertBatch == 0 {
+			if n > 0 {
+				w.WriteString(";\n")
+			}
+			fmt.Fprintf(w, "INSERT INTO `%s` (%s) VALUES\n(", table, list)
+		} else {
+			w.WriteString(",\n(")
+		}
+		for i, v := range vals {
+			if i > 0 {
+				w.WriteString(", ")
+			}
+			w.WriteString(mysqlLiteral(v, types[i].DatabaseTypeName()))
+		}
+		w.WriteByte(')')
+		n++
+	}
+	if n > 0 {
+		w.WriteString(";\n")
+	}
+	return rows.Err()
+}
+
+// readMySQLStatements calls fn for every statement of a dump, honouring DELIMITER lines and skipping comments.
+func readMySQLStatements(r io.Reader, fn func(stmt string) error) error {
+	br := bufio.NewReader(r)
+	delim := ";"
+	var stmt strings.Builder
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			t := strings.TrimRight(line, "\r\n")
+			switch {
+			case stmt.Len() == 0 && (strings.TrimSpace(t) == "" || strings.HasPrefix(t, "-- ")):
+			case stmt.Len() == 0 && strings.HasPrefix(t, "DELIMITER "):
+				delim = strings.TrimSpace(strings.TrimPrefix(t, "DELIMITER "))
+			case strings.HasSuffix(t, delim):
+				stmt.WriteString(strings.TrimSuffix(t, delim))
+				if err := fn(stmt.String()); err != nil {
+					return err
+				}
+				stmt.Reset()
+			default:
+				stmt.WriteString(t)
+				stmt.WriteByte('\n')
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if strings.TrimSpace(stmt.String()) != "" {
+		return fmt.Errorf("dump ends in the middle of a statement")
+	}
+	return nil
+}
+
+// restoreMySQLTrash creates name with the original defaults and replays the dump of e into it.
+func restoreMySQLTrash(e trash.Entry, name string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	exists, err := mysqlDBExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("database '%s' already exists; pick another name with --as", name)
+	}
+	opts := mysqlDatabaseOptions{charset: e.Options["charset"], collation: e.Options["collation"]}
+	if err := opts.validate(conn); err != nil {
+		return err
+	}
+	if err := mysqlCreateDatabase(conn, name, opts); err != nil {
+		return err
+	}
+
+	if err := loadMySQLTrash(cfg, e, name); err != nil {
+		return fmt.Errorf("%w (database '%s' was created and is partly restored)", err, name)
+	}
+	return nil
+}
+
+// loadMySQLTrash runs the dump of e inside the new database name.
+func loadMySQLTrash(cfg db.MySQLConfig, e trash.Entry, name string) error {
+	if dbViaCompose != "" {
+		return restoreComposeDump(e, map[string]string{"MYSQL_PWD": cfg.Password}, "mysql", "-u", cfg.User, "-D", name)
+	}
+	cfg.Database = name
+	dconn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer dconn.Close()
+	ctx := dbCtx
+	c, err := dconn.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	f, err := os.Open(e.Path())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	return readMySQLStatements(zr, func(stmt string) error {
+		if _, err := c.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("%w\n  in: %s", err, oneLine(stmt, 120))
+		}
+		return nil
+	})
+}
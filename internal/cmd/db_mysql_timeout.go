@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlTimeoutConnector applies --statement-timeout to MySQL. The server stops SELECTs itself through
+// max_execution_time (max_statement_time on MariaDB); any statement still running when the timeout
+// passes is stopped with KILL QUERY from a second connection, as the REPL does for Ctrl-C, so the
+// session stays usable. Socket deadlines would only drop the connection and leave the statement running.
+type mysqlTimeoutConnector struct {
+	driver.Connector
+	timeout time.Duration
+}
+
+func (c mysqlTimeoutConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	tc := &mysqlTimeoutConn{Conn: conn, connector: c}
+	if err := tc.setup(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tc, nil
+}
+
+// mysqlTimeoutConn is a driver connection whose statements are killed after the connector's timeout.
+type mysqlTimeoutConn struct {
+	driver.Conn
+	connector mysqlTimeoutConnector
+	id        string
+}
+
+// setup reads the connection id for KILL QUERY and sets the server-side limit for SELECTs.
+func (c *mysqlTimeoutConn) setup(ctx context.Context) error {
+	rows, err := c.Conn.(driver.QueryerContext).QueryContext(ctx, "SELECT CONNECTION_ID()", nil)
+	if err != nil {
+		return err
+	}
+	dest := make([]driver.Value, 1)
+	err = rows.Next(dest)
+	rows.Close()
+	if err != nil {
+		return err
+	}
+	if b, ok := dest[0].([]byte); ok {
+		c.id = string(b)
+	} else {
+		c.id = fmt.Sprint(dest[0])
+	}
+
+	exec := c.Conn.(driver.ExecerContext)
+	ms := c.connector.timeout.Milliseconds()
+	_, err = exec.ExecContext(ctx, fmt.Sprintf("SET SESSION max_execution_time = %d", ms), nil)
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1193 { // ER_UNKNOWN_SYSTEM_VARIABLE: MariaDB
+		_, err = exec.ExecContext(ctx, fmt.Sprintf("SET SESSION max_statement_time = %.3f", float64(ms)/1000), nil)
+	}
+	if errors.As(err, &me) && me.Number == 1193 {
+		err = nil // left to KILL QUERY alone
+	}
+	return err
+}
+
+// watch runs a statement and stops it with KILL QUERY when it runs past the timeout.
+func (c *mysqlTimeoutConn) watch(run func() error) error {
+	var fired atomic.Bool
+	killed := make(chan struct{})
+	t := time.AfterFunc(c.connector.timeout, func() {
+		defer close(killed)
+		fired.Store(true)
+		conn, err := c.connector.Connector.Connect(context.Background())
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.(driver.ExecerContext).ExecContext(context.Background(), "KILL QUERY "+c.id, nil)
+	})
+	err := run()
+	if !t.Stop() {
+		// The kill must not reach the next statement of this connection.
+		<-killed
+	}
+	if err != nil && fired.Load() {
+		return fmt.Errorf("statement timed out after %s: %w", c.connector.timeout, err)
+	}
+	return err
+}
+
+func (c *mysqlTimeoutConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (res driver.Result, err error) {
+	err = c.watch(func() error {
+		res, err = c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+		return err
+	})
+	return res, err
+}
+
+func (c *mysqlTimeoutConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = c.watch(func() error {
+		rows, err = c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+		return err
+	})
+	return rows, err
+}
+
+func (c *mysqlTimeoutConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.(driver.ConnPrepareContext).PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &mysqlTimeoutStmt{Stmt: stmt, conn: c}, nil
+}
+
+func (c *mysqlTimeoutConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c *mysqlTimeoutConn) Ping(ctx context.Context) error {
+	return c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+func (c *mysqlTimeoutConn) ResetSession(ctx context.Context) error {
+	return c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+func (c *mysqlTimeoutConn) IsValid() bool {
+	return c.Conn.(driver.Validator).IsValid()
+}
+
+func (c *mysqlTimeoutConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(nv)
+}
+
+// mysqlTimeoutStmt is a prepared statement of a mysqlTimeoutConn, used for queries with arguments.
+type mysqlTimeoutStmt struct {
+	driver.Stmt
+	conn *mysqlTimeoutConn
+}
+
+func (s *mysqlTimeoutStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (res driver.Result, err error) {
+	err = s.conn.watch(func() error {
+		res, err = s.Stmt.(driver.StmtExecContext).ExecContext(ctx, args)
+		return err
+	})
+	return res, err
+}
+
+func (s *mysqlTimeoutStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	err = s.conn.watch(func() error {
+		rows, err = s.Stmt.(driver.StmtQueryContext).QueryContext(ctx, args)
+		return err
+	})
+	return rows, err
+}
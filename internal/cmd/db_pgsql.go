@@ -6,12 +6,14 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 	"unicode"
 
 	"github.com/sichang824/awesome-shell/internal/config"
 	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/sichang824/awesome-shell/internal/trash"
 	"github.com/spf13/cobra"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 var (
@@ -45,20 +47,21 @@ func getPgConfig() db.PgConfig {
 		pw = os.Getenv("PG_PASS")
 	}
 	config.LoadEnv()
+	cs := composeDefaults(pgsqlCmd, "postgres", "PGHOST", "PGPORT")
 	if host == "" {
-		host = config.GetEnv("PGHOST", pgHost)
+		host = config.GetEnv("PGHOST", flagOr(pgsqlCmd, "host", cs.Host))
 	}
 	if host == "" {
 		host = "127.0.0.1"
 	}
 	if port == "" {
-		port = config.GetEnv("PGPORT", pgPort)
+		port = config.GetEnv("PGPORT", flagOr(pgsqlCmd, "port", cs.Port))
 	}
 	if port == "" {
 		port = "5432"
 	}
 	if user == "" {
-		user = pgUser
+		user = flagOr(pgsqlCmd, "user", cs.User)
 	}
 	if user == "" {
 		user = config.GetEnv("PGUSER", config.GetEnv("PG_USER", "postgres"))
@@ -67,7 +70,7 @@ func getPgConfig() db.PgConfig {
 		pw = pgPassword
 	}
 	if pw == "" {
-		pw = config.GetEnv("PG_PASSWORD", config.GetEnv("PGPASSWORD", config.GetEnv("PG_PASS", "")))
+		pw = config.GetEnv("PG_PASSWORD", config.GetEnv("PGPASSWORD", config.GetEnv("PG_PASS", cs.Password)))
 	}
 	return db.PgConfig{
 		Host:     host,
@@ -79,7 +82,77 @@ func getPgConfig() db.PgConfig {
 }
 
 func openPg(cfg db.PgConfig) (*sql.DB, error) {
-	return sql.Open("postgres", cfg.DSN())
+	if dbViaCompose != "" {
+		database := cfg.Database
+		if database == "" {
+			database = "postgres"
+		}
+		return openComposeSQL("postgres", cfg.User, cfg.Password, database), nil
+	}
+	t, err := sshTunnel()
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return sql.Open("postgres", pgDSN(cfg))
+	}
+	connector, err := pq.NewConnector(pgDSN(cfg))
+	if err != nil {
+		return nil, err
+	}
+	connector.Dialer(t)
+	return sql.OpenDB(connector), nil
+}
+
+// pgDSN is cfg.DSN with the --connect-timeout and --statement-timeout settings.
+func pgDSN(cfg db.PgConfig) string {
+	dsn := cfg.DSN()
+	if dbConnectTimeout > 0 {
+		// connect_timeout is in whole seconds.
+		dsn += fmt.Sprintf("&connect_timeout=%d", int((dbConnectTimeout+time.Second-1)/time.Second))
+	}
+	if dbStatementTimeout > 0 {
+		dsn += fmt.Sprintf("&statement_timeout=%d", dbStatementTimeout.Milliseconds())
+	}
+	return dsn
+}
+
+func pgRoleExists(conn *sql.DB, name string) (bool, error) {
+	var exists int
+	err := conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_roles WHERE rolname = $1", name).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func pgDBExists(conn *sql.DB, name string) (bool, error) {
+	var exists int
+	err := conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_database WHERE datname = $1", name).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func pgCreateDatabase(conn *sql.DB, owner, name string, opts pgDatabaseOptions) error {
+	// Identifiers in PostgreSQL: use quote_ident or safe concat; we validated with safeIdent
+	err := execSQL(conn, `CREATE DATABASE "`+name+`" WITH OWNER "`+owner+`" `+opts.clauses())
+	if err != nil || opts.timezone == "" {
+		return err
+	}
+	return execSQL(conn, `ALTER DATABASE "`+name+`" SET timezone TO '`+opts.timezone+`'`)
+}
+
+func pgCreateUser(conn *sql.DB, username, pw string, opts pgRoleOptions) error {
+	pwEsc := strings.ReplaceAll(pw, "'", "''")
+	return execSQL(conn, "CREATE ROLE \""+username+"\" WITH "+opts.clauses()+" PASSWORD '"+pwEsc+"'")
+}
+
+// pgGrant applies a privilege preset on database and its public schema.
+func pgGrant(database, username, preset string) error {
+	dbLevel, schemaLevel := pgPresetStatements(preset, database, "public", username, false)
+	return runPgPresetStatements(database, dbLevel, schemaLevel)
 }
 
 var (
@@ -109,7 +182,7 @@ var (
 	}
 	pgsqlGrantCmd = &cobra.Command{
 		Use:   "grant [database] [username]",
-		Short: "Grant all on database to user",
+		Short: "Grant privileges on database and its public schema to user (--preset, default owner = all)",
 		Args:  cobra.ExactArgs(2),
 		RunE:  runPgsqlGrant,
 	}
@@ -121,13 +194,13 @@ var (
 	}
 	pgsqlUsersCmd = &cobra.Command{
 		Use:   "users",
-		Short: "List users",
+		Short: "List roles with attributes and memberships",
 		Args:  cobra.NoArgs,
 		RunE:  runPgsqlUsers,
 	}
 	pgsqlTablesCmd = &cobra.Command{
 		Use:   "tables [database]",
-		Short: "List tables in a database",
+		Short: "List schema-qualified tables in a database (--schema to filter)",
 		Args:  cobra.ExactArgs(1),
 		RunE:  runPgsqlTables,
 	}
@@ -159,33 +232,52 @@ func runPgsqlCreateDB(cmd *cobra.Command, args []string) error {
 	}
 	defer conn.Close()
 
-	var exists int
-	err = conn.QueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", owner).Scan(&exists)
-	if err == sql.ErrNoRows {
-		fmt.Println("User '" + owner + "' does not exist.")
-		return nil
+	exists, err := pgRoleExists(conn, owner)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return noop("User '" + owner + "' does not exist.")
 	}
+	exists, err = pgDBExists(conn, database)
 	if err != nil {
 		return err
 	}
-	err = conn.QueryRow("SELECT 1 FROM pg_database WHERE datname = $1", database).Scan(&exists)
-	if err == nil {
-		fmt.Println("Database '" + database + "' already exists.")
-		return nil
+	if exists {
+		return noop("Database '" + database + "' already exists.")
+	}
+	opts := pgDatabaseOptions{
+		encoding:  pgDBEncoding,
+		locale:    pgDBLocale,
+		collation: pgDBCollation,
+		template:  pgDBTemplate,
+		timezone:  pgDBTimezone,
 	}
-	if err != sql.ErrNoRows {
+	// Check options and extensions up front so a typo does not leave a half-provisioned database.
+	if err := opts.validate(conn); err != nil {
 		return err
 	}
-	// Identifiers in PostgreSQL: use quote_ident or safe concat; we validated with safeIdent
-	_, err = conn.Exec(`CREATE DATABASE "` + database + `" WITH OWNER "` + owner + `" ENCODING 'UTF8' LC_COLLATE='en_US.utf8' LC_CTYPE='en_US.utf8' TEMPLATE=template0`)
-	if err != nil {
+	if _, err := checkPgExtensions(conn, pgCreateDBExts); err != nil {
 		return err
 	}
-	_, err = conn.Exec(`ALTER DATABASE "` + database + `" SET timezone TO 'Asia/Shanghai'`)
-	if err != nil {
+	if err := pgCreateDatabase(conn, owner, database, opts); err != nil {
 		return err
 	}
 	fmt.Println("Database '" + database + "' created.")
+	if len(pgCreateDBExts) == 0 {
+		return nil
+	}
+	dconn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer dconn.Close()
+	for _, n := range pgCreateDBExts {
+		if err := pgCreateExtension(dconn, n, "", "", true); err != nil {
+			return fmt.Errorf("%s: %w", n, err)
+		}
+		fmt.Println("Extension '" + n + "' installed.")
+	}
 	return nil
 }
 
@@ -193,6 +285,19 @@ func runPgsqlCreateUser(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[0], "username"); err != nil {
 		return err
 	}
+	opts := pgRoleOptions{
+		noLogin:    pgRoleNoLogin,
+		createDB:   pgRoleCreateDB,
+		createRole: pgRoleCreateRole,
+		validUntil: pgRoleValidUntil,
+		inRoles:    pgRoleInRoles,
+	}
+	if cmd.Flags().Changed("connection-limit") {
+		opts.connectionLimit = &pgRoleConnLimit
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
 	username := args[0]
 	pw := genPassword()
 	cfg := getPgConfig()
@@ -202,18 +307,14 @@ func runPgsqlCreateUser(cmd *cobra.Command, args []string) error {
 	}
 	defer conn.Close()
 
-	var exists int
-	err = conn.QueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", username).Scan(&exists)
-	if err == nil {
-		fmt.Println("User '" + username + "' already exists.")
-		return nil
-	}
-	if err != sql.ErrNoRows {
+	exists, err := pgRoleExists(conn, username)
+	if err != nil {
 		return err
 	}
-	pwEsc := strings.ReplaceAll(pw, "'", "''")
-	_, err = conn.Exec("CREATE USER \"" + username + "\" WITH PASSWORD '" + pwEsc + "'")
-	if err != nil {
+	if exists {
+		return noop("User '" + username + "' already exists.")
+	}
+	if err := pgCreateUser(conn, username, pw, opts); err != nil {
 		return err
 	}
 	fmt.Println("User:", username)
@@ -227,6 +328,9 @@ func runPgsqlDeleteDB(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	database := args[0]
+	if err := guardDrop("database", database, pgSystemDatabases[database]); err != nil {
+		return err
+	}
 	cfg := getPgConfig()
 	conn, err := openPg(cfg)
 	if err != nil {
@@ -235,19 +339,24 @@ func runPgsqlDeleteDB(cmd *cobra.Command, args []string) error {
 	defer conn.Close()
 
 	var exists int
-	err = conn.QueryRow("SELECT 1 FROM pg_database WHERE datname = $1", database).Scan(&exists)
+	err = conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_database WHERE datname = $1", database).Scan(&exists)
 	if err == sql.ErrNoRows {
-		fmt.Println("Database '" + database + "' does not exist.")
-		return nil
+		return noop("Database '" + database + "' does not exist.")
 	}
 	if err != nil {
 		return err
 	}
 	if !confirm("Type database name to confirm: ", database) {
-		fmt.Println("Cancelled.")
-		return nil
+		return cancelled()
 	}
-	_, err = conn.Exec(`DROP DATABASE "` + database + `"`)
+	if !dbNoBackup {
+		if err := backupToTrash("postgres", database, pgDumpFile, func(e *trash.Entry) error {
+			return dumpPgDatabase(cfg, database, e)
+		}); err != nil {
+			return err
+		}
+	}
+	err = execSQL(conn, `DROP DATABASE "`+database+`"`)
 	if err != nil {
 		return err
 	}
@@ -261,6 +370,9 @@ func runPgsqlDeleteUser(cmd *cobra.Command, args []string) error {
 	}
 	username := args[0]
 	cfg := getPgConfig()
+	if err := guardDrop("user", username, pgSystemUsers[username] || username == cfg.User); err != nil {
+		return err
+	}
 	conn, err := openPg(cfg)
 	if err != nil {
 		return err
@@ -268,19 +380,17 @@ func runPgsqlDeleteUser(cmd *cobra.Command, args []string) error {
 	defer conn.Close()
 
 	var exists int
-	err = conn.QueryRow("SELECT 1 FROM pg_roles WHERE rolname = $1", username).Scan(&exists)
+	err = conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_roles WHERE rolname = $1", username).Scan(&exists)
 	if err == sql.ErrNoRows {
-		fmt.Println("User '" + username + "' does not exist.")
-		return nil
+		return noop("User '" + username + "' does not exist.")
 	}
 	if err != nil {
 		return err
 	}
 	if !confirm("Type username to confirm: ", username) {
-		fmt.Println("Cancelled.")
-		return nil
+		return cancelled()
 	}
-	_, err = conn.Exec(`DROP USER "` + username + `"`)
+	err = execSQL(conn, `DROP USER "`+username+`"`)
 	if err != nil {
 		return err
 	}
@@ -295,24 +405,13 @@ func runPgsqlGrant(cmd *cobra.Command, args []string) error {
 	if err := requireSafeIdent(args[1], "username"); err != nil {
 		return err
 	}
-	database, username := args[0], args[1]
-	cfg := getPgConfig()
-	conn, err := openPg(cfg)
-	if err != nil {
+	if err := checkPreset(pgGrantPreset); err != nil {
 		return err
 	}
-	defer conn.Close()
-
-	for _, q := range []string{
-		`GRANT ALL PRIVILEGES ON DATABASE "` + database + `" TO "` + username + `"`,
-		`GRANT USAGE ON SCHEMA public TO "` + username + `"`,
-		`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA public TO "` + username + `"`,
-		`GRANT ALL PRIVILEGES ON ALL SEQUENCES IN SCHEMA public TO "` + username + `"`,
-	} {
-		_, err = conn.Exec(q)
-		if err != nil {
-			return err
-		}
+	database, username := args[0], args[1]
+	// Schema, table and sequence grants must run inside the target database.
+	if err := pgGrant(database, username, pgGrantPreset); err != nil {
+		return err
 	}
 	fmt.Println("Granted.")
 	return nil
@@ -325,29 +424,7 @@ func runPgsqlDbs(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer conn.Close()
-	rows, err := conn.Query("SELECT datname FROM pg_database WHERE datistemplate = false ORDER BY datname")
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
-	for rows.Next() {
-		var name string
-		if err := rows.Scan(&name); err != nil {
-			return err
-		}
-		fmt.Println(name)
-	}
-	return rows.Err()
-}
-
-func runPgsqlUsers(cmd *cobra.Command, args []string) error {
-	cfg := getPgConfig()
-	conn, err := openPg(cfg)
-	if err != nil {
-		return err
-	}
-	defer conn.Close()
-	rows, err := conn.Query("SELECT usename FROM pg_user ORDER BY usename")
+	rows, err := conn.QueryContext(dbCtx, "SELECT datname FROM pg_database WHERE datistemplate = false ORDER BY datname")
 	if err != nil {
 		return err
 	}
@@ -374,7 +451,14 @@ func runPgsqlTables(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	defer conn.Close()
-	rows, err := conn.Query("SELECT tablename FROM pg_tables WHERE schemaname = 'public' ORDER BY tablename")
+	q := `SELECT schemaname || '.' || tablename FROM pg_tables
+		WHERE schemaname NOT LIKE 'pg\_%' AND schemaname <> 'information_schema'`
+	var params []interface{}
+	if pgTablesSchemaName != "" {
+		q += " AND schemaname = $1"
+		params = append(params, pgTablesSchemaName)
+	}
+	rows, err := conn.QueryContext(dbCtx, q+" ORDER BY schemaname, tablename", params...)
 	if err != nil {
 		return err
 	}
@@ -390,16 +474,25 @@ func runPgsqlTables(cmd *cobra.Command, args []string) error {
 }
 
 func runPgREPL(conn *sql.DB) error {
+	f, err := newValueFormatter("postgres")
+	if err != nil {
+		return err
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	var buf strings.Builder
-	fmt.Fprintln(os.Stderr, "Go driver REPL (\\q to quit)")
+	session, err := openSQLREPLSession(conn, "SELECT pg_backend_pid()", "SELECT pg_cancel_backend(%d)")
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	fmt.Fprintln(os.Stderr, "Go driver REPL (\\q to quit, Ctrl-C cancels the running statement)")
 	for {
 		if buf.Len() > 0 {
 			fmt.Fprint(os.Stderr, "... ")
 		} else {
 			fmt.Fprint(os.Stderr, "pgsql> ")
 		}
-		if !scanner.Scan() {
+		if !scanREPLLine(scanner) {
 			break
 		}
 		line := scanner.Text()
@@ -422,53 +515,19 @@ func runPgREPL(conn *sql.DB) error {
 		if stmt == "" {
 			continue
 		}
-		rows, err := conn.Query(stmt)
-		if err != nil {
-			result, execErr := conn.Exec(stmt)
-			if execErr != nil {
-				fmt.Fprintln(os.Stderr, "ERROR:", err)
-				continue
-			}
-			affected, _ := result.RowsAffected()
-			fmt.Println("OK", affected, "row(s) affected")
-			continue
-		}
-		cols, _ := rows.Columns()
-		if len(cols) == 0 {
-			_ = rows.Close()
-			continue
-		}
-		fmt.Println(strings.Join(cols, "\t"))
-		vals := make([]interface{}, len(cols))
-		ptrs := make([]interface{}, len(cols))
-		for i := range vals {
-			ptrs[i] = &vals[i]
-		}
-		for rows.Next() {
-			if err := rows.Scan(ptrs...); err != nil {
-				fmt.Fprintln(os.Stderr, "ERROR:", err)
-				break
-			}
-			parts := make([]string, len(cols))
-			for i, v := range vals {
-				if v == nil {
-					parts[i] = "NULL"
-				} else {
-					parts[i] = fmt.Sprint(v)
-				}
-			}
-			fmt.Println(strings.Join(parts, "\t"))
+		session.run(stmt, f)
+		if dbCtx.Err() != nil {
+			return dbCtx.Err()
 		}
-		if err := rows.Err(); err != nil {
-			fmt.Fprintln(os.Stderr, "ERROR:", err)
-		}
-		_ = rows.Close()
 	}
 	return scanner.Err()
 }
 
 func runPgsqlClient(cmd *cobra.Command, args []string) error {
 	cfg := getPgConfig()
+	if dbViaCompose != "" {
+		return runComposeClient("postgres", cfg.User, cfg.Password, cfg.Database)
+	}
 	conn, err := openPg(cfg)
 	if err != nil {
 		return err
@@ -492,6 +551,9 @@ func runPgsqlLogin(cmd *cobra.Command, args []string) error {
 	}
 	cfg.User = user
 	cfg.Password = password
+	if dbViaCompose != "" {
+		return runComposeClient("postgres", cfg.User, cfg.Password, cfg.Database)
+	}
 	conn, err := openPg(cfg)
 	if err != nil {
 		return err
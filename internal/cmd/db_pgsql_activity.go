@@ -0,0 +1,302 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgActivityWatch    time.Duration
+	pgActivityActive   bool
+	pgActivityQueryLen int
+	pgKillTerminate    bool
+)
+
+var (
+	pgsqlActivityCmd = &cobra.Command{
+		Use:   "activity",
+		Short: "List sessions from pg_stat_activity (state, wait event, duration, query)",
+		Args:  cobra.NoArgs,
+		RunE:  runPgsqlActivity,
+	}
+	pgsqlLocksCmd = &cobra.Command{
+		Use:   "locks",
+		Short: "Show the lock blocking tree (who blocks whom)",
+		Args:  cobra.NoArgs,
+		RunE:  runPgsqlLocks,
+	}
+	pgsqlKillCmd = &cobra.Command{
+		Use:   "kill [pid]",
+		Short: "Cancel a backend's query (pg_cancel_backend) or terminate it with --terminate",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlKill,
+	}
+)
+
+func init() {
+	pgsqlActivityCmd.Flags().DurationVar(&pgActivityWatch, "watch", 0, "refresh every interval (e.g. 2s) until Ctrl-C")
+	pgsqlActivityCmd.Flags().BoolVar(&pgActivityActive, "active", false, "hide idle sessions")
+	pgsqlActivityCmd.Flags().IntVar(&pgActivityQueryLen, "query-width", 80, "truncate queries to this many characters (0 = no limit)")
+	pgsqlLocksCmd.Flags().DurationVar(&pgActivityWatch, "watch", 0, "refresh every interval (e.g. 2s) until Ctrl-C")
+	pgsqlLocksCmd.Flags().IntVar(&pgActivityQueryLen, "query-width", 80, "truncate queries to this many characters (0 = no limit)")
+	pgsqlKillCmd.Flags().BoolVar(&pgKillTerminate, "terminate", false, "terminate the whole backend (pg_terminate_backend) instead of cancelling its query")
+	pgsqlCmd.AddCommand(pgsqlActivityCmd, pgsqlLocksCmd, pgsqlKillCmd)
+}
+
+// watchLoop runs fn once, or every interval with a cleared screen until Ctrl-C cancels dbCtx.
+func watchLoop(interval time.Duration, fn func() error) error {
+	if interval <= 0 {
+		return fn()
+	}
+	for {
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: %s\n\n", interval, time.Now().Format("2006-01-02 15:04:05"))
+		if err := fn(); err != nil {
+			return err
+		}
+		select {
+		case <-dbCtx.Done():
+			return dbCtx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// oneLine collapses whitespace in a query and truncates it to max characters (0 = no limit).
+func oneLine(s string, max int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if max > 0 && len([]rune(s)) > max {
+		return string([]rune(s)[:max]) + "..."
+	}
+	return s
+}
+
+// formatSeconds renders a duration given in seconds, or "-" when unknown.
+func formatSeconds(sec sql.NullFloat64) string {
+	if !sec.Valid {
+		return "-"
+	}
+	return (time.Duration(sec.Float64 * float64(time.Second))).Round(time.Second).String()
+}
+
+type pgSession struct {
+	pid       int64
+	user      string
+	database  string
+	client    string
+	state     string
+	wait      string
+	seconds   sql.NullFloat64
+	query     string
+	blockedBy []int64
+}
+
+const pgSessionsQuery = `SELECT pid, COALESCE(usename, ''), COALESCE(datname, ''),
+	COALESCE(host(client_addr), 'local'), COALESCE(state, ''),
+	COALESCE(wait_event_type || ':' || wait_event, ''),
+	EXTRACT(EPOCH FROM now() - COALESCE(query_start, backend_start))::float8,
+	COALESCE(query, ''), pg_blocking_pids(pid)
+FROM pg_stat_activity
+WHERE pid <> pg_backend_pid() AND backend_type = 'client backend'
+ORDER BY query_start NULLS LAST`
+
+func listPgSessions(conn *sql.DB) ([]pgSession, error) {
+	rows, err := conn.QueryContext(dbCtx, pgSessionsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var sessions []pgSession
+	for rows.Next() {
+		var s pgSession
+		var blockedBy pq.Int64Array
+		if err := rows.Scan(&s.pid, &s.user, &s.database, &s.client, &s.state, &s.wait, &s.seconds, &s.query, &blockedBy); err != nil {
+			return nil, err
+		}
+		s.blockedBy = blockedBy
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func runPgsqlActivity(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return watchLoop(pgActivityWatch, func() error {
+		sessions, err := listPgSessions(conn)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PID\tUSER\tDATABASE\tCLIENT\tSTATE\tWAIT\tDURATION\tQUERY")
+		for _, s := range sessions {
+			if pgActivityActive && (s.state == "idle" || s.state == "") {
+				continue
+			}
+			wait := s.wait
+			if wait == "" {
+				wait = "-"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.pid, s.user, s.database, s.client, s.state, wait,
+				formatSeconds(s.seconds), oneLine(s.query, pgActivityQueryLen))
+		}
+		return w.Flush()
+	})
+}
+
+type pgWaitingLock struct {
+	locktype, mode, relation string
+}
+
+func runPgsqlLocks(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return watchLoop(pgActivityWatch, func() error {
+		sessions, err := listPgSessions(conn)
+		if err != nil {
+			return err
+		}
+		waiting := map[int64]pgWaitingLock{}
+		rows, err := conn.QueryContext(dbCtx, `SELECT pid, locktype, mode, COALESCE(relation::regclass::text, '')
+			FROM pg_locks WHERE NOT granted AND pid IS NOT NULL`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var pid int64
+			var l pgWaitingLock
+			if err := rows.Scan(&pid, &l.locktype, &l.mode, &l.relation); err != nil {
+				rows.Close()
+				return err
+			}
+			waiting[pid] = l
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		printPgBlockingTree(sessions, waiting)
+		return nil
+	})
+}
+
+// printPgBlockingTree prints each blocking session that is not itself blocked, with the sessions it blocks indented beneath it.
+func printPgBlockingTree(sessions []pgSession, waiting map[int64]pgWaitingLock) {
+	byPid := map[int64]pgSession{}
+	children := map[int64][]int64{}
+	blocked := map[int64]bool{}
+	for _, s := range sessions {
+		byPid[s.pid] = s
+		for _, b := range s.blockedBy {
+			children[b] = append(children[b], s.pid)
+			blocked[s.pid] = true
+		}
+	}
+	var roots []int64
+	for pid := range children {
+		if !blocked[pid] {
+			roots = append(roots, pid)
+		}
+	}
+	if len(roots) == 0 {
+		// Every blocker is itself blocked: a deadlock cycle the server has not resolved yet.
+		for pid := range children {
+			roots = append(roots, pid)
+		}
+	}
+	if len(roots) == 0 {
+		fmt.Println("No blocked sessions.")
+		return
+	}
+	sort.Slice(roots, func(i, j int) bool { return roots[i] < roots[j] })
+	seen := map[int64]bool{}
+	var walk func(pid int64, depth int)
+	walk = func(pid int64, depth int) {
+		indent := strings.Repeat("  ", depth)
+		s, ok := byPid[pid]
+		line := indent + "pid " + strconv.FormatInt(pid, 10)
+		if ok {
+			line += fmt.Sprintf(" [%s@%s %s %s] %s", s.user, s.database, s.state, formatSeconds(s.seconds), oneLine(s.query, pgActivityQueryLen))
+		}
+		if l, ok := waiting[pid]; ok {
+			line += fmt.Sprintf("\n%s  waits for %s lock (%s %s)", indent, l.mode, l.locktype, l.relation)
+		}
+		fmt.Println(line)
+		if seen[pid] {
+			return
+		}
+		seen[pid] = true
+		kids := children[pid]
+		sort.Slice(kids, func(i, j int) bool { return kids[i] < kids[j] })
+		for _, k := range kids {
+			walk(k, depth+1)
+		}
+	}
+	for _, r := range roots {
+		if !seen[r] {
+			walk(r, 0)
+		}
+	}
+}
+
+func runPgsqlKill(cmd *cobra.Command, args []string) error {
+	pid, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || pid <= 0 {
+		return fmt.Errorf("invalid pid %q", args[0])
+	}
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var user, database, state, query string
+	err = conn.QueryRowContext(dbCtx, "SELECT COALESCE(usename, ''), COALESCE(datname, ''), COALESCE(state, ''), COALESCE(query, '') FROM pg_stat_activity WHERE pid = $1", pid).
+		Scan(&user, &database, &state, &query)
+	if err == sql.ErrNoRows {
+		return noop(fmt.Sprintf("Backend %d does not exist.", pid))
+	}
+	if err != nil {
+		return err
+	}
+	action, fn := "Cancel query of", "pg_cancel_backend"
+	if pgKillTerminate {
+		action, fn = "Terminate", "pg_terminate_backend"
+	}
+	fmt.Printf("%s backend %d (%s@%s, %s): %s\n", action, pid, user, database, state, oneLine(query, 120))
+	if !confirm("Type pid to confirm: ", args[0]) {
+		return cancelled()
+	}
+	if exec.DryRun {
+		fmt.Printf("[dry-run] SELECT %s(%d);\n", fn, pid)
+		return nil
+	}
+	var ok bool
+	if err := conn.QueryRowContext(dbCtx, "SELECT "+fn+"($1)", pid).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%s(%d) returned false", fn, pid)
+	}
+	fmt.Println("Signal sent.")
+	return nil
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	osexec "os/exec"
+	"regexp"
+	"strconv"
+
+	"github.com/sichang824/awesome-shell/internal/db"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
+)
+
+// pgDumpFile is the pg_dump custom-format archive of a PostgreSQL backup.
+const pgDumpFile = "dump.pgdump"
+
+// pgToolArgs returns the connection arguments shared by pg_dump and pg_restore; the password goes via PGPASSWORD.
+// The closer ends the --ssh forward and must be closed once the tool has exited.
+func pgToolArgs(cfg db.PgConfig) ([]string, io.Closer, error) {
+	host, port, closer, err := toolAddress(cfg.Host, cfg.Port)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []string{"-h", host, "-p", port, "-U", cfg.User, "-w"}, closer, nil
+}
+
+// pgToolVersion matches the major version in "pg_dump (PostgreSQL) 16.2".
+var pgToolVersion = regexp.MustCompile(`\(PostgreSQL\) (\d+)`)
+
+// checkPgTool makes sure the host's pg_dump or pg_restore is installed and not older than the server,
+// since pg_dump refuses newer servers and an old pg_restore cannot read their archives.
+func checkPgTool(conn *sql.DB, tool string) error {
+	if _, err := osexec.LookPath(tool); err != nil {
+		return fmt.Errorf("%s not found: PostgreSQL backups use the PostgreSQL client tools on this host (e.g. the postgresql-client package)", tool)
+	}
+	out, _, err := exec.RunReadOnly(tool, "--version")
+	if err != nil {
+		return fmt.Errorf("%s --version: %w", tool, err)
+	}
+	m := pgToolVersion.FindStringSubmatch(out)
+	if m == nil {
+		return nil
+	}
+	var serverNum int
+	if err := conn.QueryRowContext(dbCtx, "SHOW server_version_num").Scan(&serverNum); err != nil {
+		return err
+	}
+	client, _ := strconv.Atoi(m[1])
+	if server := serverNum / 10000; client < server {
+		return fmt.Errorf("%s is version %d but the server runs PostgreSQL %d; install client tools %d or newer", tool, client, server, server)
+	}
+	return nil
+}
+
+// dumpPgDatabase archives database with pg_dump and records its owner, encoding and locale for the restore.
+func dumpPgDatabase(cfg db.PgConfig, database string, e *trash.Entry) error {
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	var owner, encoding, collate, ctype string
+	if err := conn.QueryRowContext(dbCtx, `SELECT pg_get_userbyid(datdba), pg_encoding_to_char(encoding), datcollate, datctype
+FROM pg_database WHERE datname = $1`, database).Scan(&owner, &encoding, &collate, &ctype); err != nil {
+		return err
+	}
+	e.Options["owner"], e.Options["encoding"], e.Options["collate"], e.Options["ctype"] = owner, encoding, collate, ctype
+	if dbViaCompose != "" {
+		return dumpComposePg(cfg.User, cfg.Password, database, e)
+	}
+	if err := checkPgTool(conn, "pg_dump"); err != nil {
+		return err
+	}
+	args, forward, err := pgToolArgs(cfg)
+	if err != nil {
+		return err
+	}
+	defer forward.Close()
+	args = append(args, "-Fc", "-f", e.Path(), database)
+	if err := exec.RunInheritWithEnv(map[string]string{"PGPASSWORD": cfg.Password}, "pg_dump", args...); err != nil {
+		return fmt.Errorf("pg_dump: %w", err)
+	}
+	return nil
+}
+
+// restorePgTrash creates name like the original database and loads the archive of e with pg_restore.
+func restorePgTrash(e trash.Entry, name string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	exists, err := pgDBExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return fmt.Errorf("database '%s' already exists; pick another name with --as", name)
+	}
+	if dbViaCompose == "" {
+		if err := checkPgTool(conn, "pg_restore"); err != nil {
+			return err
+		}
+	}
+	owner := e.Options["owner"]
+	if ok, err := pgRoleExists(conn, owner); err != nil {
+		return err
+	} else if !ok {
+		fmt.Println("Owner '" + owner + "' no longer exists, the database will be owned by '" + cfg.User + "'.")
+		owner = cfg.User
+	}
+	opts := pgDatabaseOptions{encoding: e.Options["encoding"], locale: e.Options["ctype"]}
+	if c := e.Options["collate"]; c != opts.locale {
+		opts.collation = c
+	}
+	if err := pgCreateDatabase(conn, owner, name, opts); err != nil {
+		return err
+	}
+	if dbViaCompose != "" {
+		err := restoreComposeDump(e, map[string]string{"PGPASSWORD": cfg.Password}, "pg_restore", "-U", cfg.User, "-d", name)
+		if err != nil {
+			return fmt.Errorf("pg_restore: %w (database '%s' was created; see the messages above)", err, name)
+		}
+		return nil
+	}
+	args, forward, err := pgToolArgs(cfg)
+	if err != nil {
+		return err
+	}
+	defer forward.Close()
+	args = append(args, "-d", name, e.Path())
+	if err := exec.RunInheritWithEnv(map[string]string{"PGPASSWORD": cfg.Password}, "pg_restore", args...); err != nil {
+		return fmt.Errorf("pg_restore: %w (database '%s' was created; see the messages above)", err, name)
+	}
+	return nil
+}
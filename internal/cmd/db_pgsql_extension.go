@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgExtInstalledOnly bool
+	pgExtVersion       string
+	pgExtSchema        string
+	pgExtCascade       bool
+	pgCreateDBExts     []string
+)
+
+var (
+	pgsqlExtensionsCmd = &cobra.Command{
+		Use:   "extensions",
+		Short: "Manage extensions in a database",
+	}
+	pgsqlExtListCmd = &cobra.Command{
+		Use:   "list [database]",
+		Short: "List available extensions with default and installed versions",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlExtList,
+	}
+	pgsqlExtInstallCmd = &cobra.Command{
+		Use:   "install [database] [extension...]",
+		Short: "Install extensions (CREATE EXTENSION IF NOT EXISTS)",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  runPgsqlExtInstall,
+	}
+	pgsqlExtRemoveCmd = &cobra.Command{
+		Use:   "remove [database] [extension...]",
+		Short: "Remove extensions (with confirmation)",
+		Args:  cobra.MinimumNArgs(2),
+		RunE:  runPgsqlExtRemove,
+	}
+	pgsqlExtUpdateCmd = &cobra.Command{
+		Use:   "update [database] [extension...]",
+		Short: "Update extensions to their default version (all outdated ones if none given)",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runPgsqlExtUpdate,
+	}
+)
+
+func init() {
+	pgsqlExtListCmd.Flags().BoolVar(&pgExtInstalledOnly, "installed", false, "only installed extensions")
+	pgsqlExtInstallCmd.Flags().StringVar(&pgExtVersion, "version", "", "install this version instead of the default")
+	pgsqlExtInstallCmd.Flags().StringVar(&pgExtSchema, "schema", "", "schema to install into (default: first in search_path)")
+	pgsqlExtInstallCmd.Flags().BoolVar(&pgExtCascade, "cascade", false, "also install extensions this one requires")
+	pgsqlExtRemoveCmd.Flags().BoolVar(&pgExtCascade, "cascade", false, "also drop objects that depend on the extension")
+	pgsqlExtUpdateCmd.Flags().StringVar(&pgExtVersion, "version", "", "update to this version instead of the default (single extension only)")
+	pgsqlCreateDBCmd.Flags().StringSliceVar(&pgCreateDBExts, "extensions", nil, "install these extensions in the new database (comma-separated)")
+	pgsqlExtensionsCmd.AddCommand(pgsqlExtListCmd, pgsqlExtInstallCmd, pgsqlExtRemoveCmd, pgsqlExtUpdateCmd)
+	pgsqlCmd.AddCommand(pgsqlExtensionsCmd)
+}
+
+// pgExtension is a row of pg_available_extensions.
+type pgExtension struct {
+	name, defaultVersion, installedVersion, comment string
+}
+
+func listPgExtensions(conn *sql.DB) (map[string]pgExtension, []string, error) {
+	rows, err := conn.QueryContext(dbCtx, `SELECT name, COALESCE(default_version, ''), COALESCE(installed_version, ''), COALESCE(comment, '')
+		FROM pg_available_extensions ORDER BY name`)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	byName := map[string]pgExtension{}
+	var names []string
+	for rows.Next() {
+		var e pgExtension
+		if err := rows.Scan(&e.name, &e.defaultVersion, &e.installedVersion, &e.comment); err != nil {
+			return nil, nil, err
+		}
+		byName[e.name] = e
+		names = append(names, e.name)
+	}
+	return byName, names, rows.Err()
+}
+
+// checkPgExtensions validates names and makes sure the server ships each extension.
+func checkPgExtensions(conn *sql.DB, names []string) (map[string]pgExtension, error) {
+	for _, n := range names {
+		if err := requireSafeIdent(n, "extension"); err != nil {
+			return nil, err
+		}
+	}
+	available, _, err := listPgExtensions(conn)
+	if err != nil {
+		return nil, err
+	}
+	var missing []string
+	for _, n := range names {
+		if _, ok := available[n]; !ok {
+			missing = append(missing, n)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("extension(s) not available on this server: %s", strings.Join(missing, ", "))
+	}
+	return available, nil
+}
+
+// pgCreateExtension installs name in the database conn is connected to.
+func pgCreateExtension(conn *sql.DB, name, version, schema string, cascade bool) error {
+	q := `CREATE EXTENSION IF NOT EXISTS "` + name + `"`
+	if schema != "" {
+		q += ` SCHEMA "` + schema + `"`
+	}
+	if version != "" {
+		q += " VERSION '" + strings.ReplaceAll(version, "'", "''") + "'"
+	}
+	if cascade {
+		q += " CASCADE"
+	}
+	return execSQL(conn, q)
+}
+
+func runPgsqlExtList(cmd *cobra.Command, args []string) error {
+	conn, err := openPgDatabase(args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	byName, names, err := listPgExtensions(conn)
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tDEFAULT\tINSTALLED\tCOMMENT")
+	for _, n := range names {
+		e := byName[n]
+		if pgExtInstalledOnly && e.installedVersion == "" {
+			continue
+		}
+		installed := e.installedVersion
+		if installed == "" {
+			installed = "-"
+		} else if installed != e.defaultVersion {
+			installed += " (update available)"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.name, e.defaultVersion, installed, oneLine(e.comment, 60))
+	}
+	return w.Flush()
+}
+
+func runPgsqlExtInstall(cmd *cobra.Command, args []string) error {
+	database, names := args[0], args[1:]
+	if pgExtSchema != "" {
+		if err := requireSafeIdent(pgExtSchema, "schema"); err != nil {
+			return err
+		}
+	}
+	if pgExtVersion != "" && len(names) > 1 {
+		return fmt.Errorf("--version applies to a single extension")
+	}
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	available, err := checkPgExtensions(conn, names)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if v := available[n].installedVersion; v != "" {
+			fmt.Println("Extension '" + n + "' already installed (" + v + ").")
+			continue
+		}
+		if err := pgCreateExtension(conn, n, pgExtVersion, pgExtSchema, pgExtCascade); err != nil {
+			return fmt.Errorf("%s: %w", n, err)
+		}
+		fmt.Println("Extension '" + n + "' installed.")
+	}
+	return nil
+}
+
+func runPgsqlExtRemove(cmd *cobra.Command, args []string) error {
+	database, names := args[0], args[1:]
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	available, err := checkPgExtensions(conn, names)
+	if err != nil {
+		return err
+	}
+	var installed []string
+	for _, n := range names {
+		if err := guardDrop("extension", n, n == "plpgsql"); err != nil {
+			return err
+		}
+		if available[n].installedVersion == "" {
+			fmt.Println("Extension '" + n + "' is not installed.")
+			continue
+		}
+		installed = append(installed, n)
+	}
+	if len(installed) == 0 {
+		return nil
+	}
+	fmt.Println("Remove from '" + database + "': " + strings.Join(installed, ", "))
+	if !confirm("Type database name to confirm: ", database) {
+		return cancelled()
+	}
+	for _, n := range installed {
+		q := `DROP EXTENSION "` + n + `"`
+		if pgExtCascade {
+			q += " CASCADE"
+		}
+		if err := execSQL(conn, q); err != nil {
+			return fmt.Errorf("%s: %w", n, err)
+		}
+		fmt.Println("Extension '" + n + "' removed.")
+	}
+	return nil
+}
+
+func runPgsqlExtUpdate(cmd *cobra.Command, args []string) error {
+	database, names := args[0], args[1:]
+	if pgExtVersion != "" && len(names) != 1 {
+		return fmt.Errorf("--version applies to a single extension")
+	}
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	available, err := checkPgExtensions(conn, names)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		for n, e := range available {
+			if e.installedVersion != "" && e.installedVersion != e.defaultVersion {
+				names = append(names, n)
+			}
+		}
+		if len(names) == 0 {
+			fmt.Println("All extensions are up to date.")
+			return nil
+		}
+		sort.Strings(names)
+	}
+	for _, n := range names {
+		e := available[n]
+		target := pgExtVersion
+		if target == "" {
+			target = e.defaultVersion
+		}
+		switch {
+		case e.installedVersion == "":
+			fmt.Println("Extension '" + n + "' is not installed.")
+			continue
+		case e.installedVersion == target:
+			fmt.Println("Extension '" + n + "' is already at " + target + ".")
+			continue
+		}
+		q := `ALTER EXTENSION "` + n + `" UPDATE`
+		if pgExtVersion != "" {
+			q += " TO '" + strings.ReplaceAll(pgExtVersion, "'", "''") + "'"
+		}
+		if err := execSQL(conn, q); err != nil {
+			return fmt.Errorf("%s: %w", n, err)
+		}
+		fmt.Println("Extension '" + n + "' updated " + e.installedVersion + " -> " + target + ".")
+	}
+	return nil
+}
@@ -0,0 +1,260 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgRoleNoLogin, pgRoleCreateDB, pgRoleCreateRole bool
+	pgRoleConnLimit                                 int
+	pgRoleValidUntil                                string
+	pgRoleInRoles                                   []string
+	pgRoleAdminOption                               bool
+)
+
+var (
+	pgsqlCreateRoleCmd = &cobra.Command{
+		Use:   "create-role [name]",
+		Short: "Create a group role (NOLOGIN) that users can be made members of",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlCreateRole,
+	}
+	pgsqlRoleCmd = &cobra.Command{
+		Use:   "role",
+		Short: "Manage role membership",
+	}
+	pgsqlRoleGrantCmd = &cobra.Command{
+		Use:   "grant [role] [member]",
+		Short: "Make member a member of role (GRANT role TO member)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlRoleGrant,
+	}
+	pgsqlRoleRevokeCmd = &cobra.Command{
+		Use:   "revoke [role] [member]",
+		Short: "Remove member from role (REVOKE role FROM member)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlRoleRevoke,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{pgsqlCreateUserCmd, pgsqlCreateRoleCmd} {
+		f := c.Flags()
+		f.BoolVar(&pgRoleCreateDB, "createdb", false, "allow creating databases (CREATEDB)")
+		f.BoolVar(&pgRoleCreateRole, "createrole", false, "allow creating roles (CREATEROLE)")
+		f.StringSliceVar(&pgRoleInRoles, "in-role", nil, "join these existing roles (comma-separated)")
+	}
+	f := pgsqlCreateUserCmd.Flags()
+	f.BoolVar(&pgRoleNoLogin, "nologin", false, "create without LOGIN (password is still set)")
+	f.IntVar(&pgRoleConnLimit, "connection-limit", -1, "maximum concurrent connections (-1 = unlimited)")
+	f.StringVar(&pgRoleValidUntil, "valid-until", "", "password expiry: date/time (e.g. 2025-12-31 or 2025-12-31T23:59:59Z) or infinity")
+	pgsqlRoleGrantCmd.Flags().BoolVar(&pgRoleAdminOption, "admin", false, "let member grant the role to others (WITH ADMIN OPTION)")
+	pgsqlRoleCmd.AddCommand(pgsqlRoleGrantCmd, pgsqlRoleRevokeCmd)
+	pgsqlCmd.AddCommand(pgsqlCreateRoleCmd, pgsqlRoleCmd)
+}
+
+// pgRoleOptions are the CREATE ROLE attributes beyond name and password.
+type pgRoleOptions struct {
+	noLogin, createDB, createRole bool
+	connectionLimit               *int // nil = server default
+	validUntil                    string
+	inRoles                       []string
+}
+
+func (o pgRoleOptions) validate() error {
+	if o.connectionLimit != nil && *o.connectionLimit < -1 {
+		return fmt.Errorf("invalid --connection-limit %d", *o.connectionLimit)
+	}
+	if o.validUntil != "" && o.validUntil != "infinity" {
+		ok := false
+		for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339} {
+			if _, err := time.Parse(layout, o.validUntil); err == nil {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("invalid --valid-until %q (use YYYY-MM-DD, YYYY-MM-DD HH:MM:SS, RFC 3339 or infinity)", o.validUntil)
+		}
+	}
+	for _, r := range o.inRoles {
+		if err := requireSafeIdent(r, "role"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clauses renders the attribute list that follows CREATE ROLE "name" WITH.
+func (o pgRoleOptions) clauses() string {
+	var parts []string
+	if o.noLogin {
+		parts = append(parts, "NOLOGIN")
+	} else {
+		parts = append(parts, "LOGIN")
+	}
+	if o.createDB {
+		parts = append(parts, "CREATEDB")
+	}
+	if o.createRole {
+		parts = append(parts, "CREATEROLE")
+	}
+	if o.connectionLimit != nil {
+		parts = append(parts, "CONNECTION LIMIT "+strconv.Itoa(*o.connectionLimit))
+	}
+	if o.validUntil != "" {
+		parts = append(parts, "VALID UNTIL '"+o.validUntil+"'")
+	}
+	if len(o.inRoles) > 0 {
+		parts = append(parts, `IN ROLE "`+strings.Join(o.inRoles, `", "`)+`"`)
+	}
+	return strings.Join(parts, " ")
+}
+
+func runPgsqlCreateRole(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "role"); err != nil {
+		return err
+	}
+	name := args[0]
+	opts := pgRoleOptions{noLogin: true, createDB: pgRoleCreateDB, createRole: pgRoleCreateRole, inRoles: pgRoleInRoles}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := pgRoleExists(conn, name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return noop("Role '" + name + "' already exists.")
+	}
+	if err := execSQL(conn, `CREATE ROLE "`+name+`" WITH `+opts.clauses()); err != nil {
+		return err
+	}
+	fmt.Println("Role '" + name + "' created.")
+	return nil
+}
+
+func pgRoleMembershipArgs(conn *sql.DB, args []string) (role, member string, err error) {
+	if err := requireSafeIdent(args[0], "role"); err != nil {
+		return "", "", err
+	}
+	if err := requireSafeIdent(args[1], "member"); err != nil {
+		return "", "", err
+	}
+	for _, name := range args {
+		exists, err := pgRoleExists(conn, name)
+		if err != nil {
+			return "", "", err
+		}
+		if !exists {
+			return "", "", fmt.Errorf("role '%s' does not exist", name)
+		}
+	}
+	return args[0], args[1], nil
+}
+
+func runPgsqlRoleGrant(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	role, member, err := pgRoleMembershipArgs(conn, args)
+	if err != nil {
+		return err
+	}
+	stmt := `GRANT "` + role + `" TO "` + member + `"`
+	if pgRoleAdminOption {
+		stmt += " WITH ADMIN OPTION"
+	}
+	if err := execSQL(conn, stmt); err != nil {
+		return err
+	}
+	fmt.Println("'" + member + "' is now a member of '" + role + "'.")
+	return nil
+}
+
+func runPgsqlRoleRevoke(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	role, member, err := pgRoleMembershipArgs(conn, args)
+	if err != nil {
+		return err
+	}
+	if err := execSQL(conn, `REVOKE "`+role+`" FROM "`+member+`"`); err != nil {
+		return err
+	}
+	fmt.Println("'" + member + "' removed from '" + role + "'.")
+	return nil
+}
+
+const pgUsersQuery = `SELECT r.rolname, r.rolcanlogin, r.rolsuper, r.rolcreatedb, r.rolcreaterole, r.rolconnlimit,
+	COALESCE(CASE WHEN r.rolvaliduntil = 'infinity' THEN 'infinity' ELSE to_char(r.rolvaliduntil, 'YYYY-MM-DD HH24:MI') END, '-'),
+	COALESCE(array_agg(g.rolname ORDER BY g.rolname) FILTER (WHERE g.rolname IS NOT NULL), '{}')
+FROM pg_roles r
+LEFT JOIN pg_auth_members m ON m.member = r.oid
+LEFT JOIN pg_roles g ON g.oid = m.roleid
+WHERE r.rolname NOT LIKE 'pg\_%'
+GROUP BY r.oid, r.rolname, r.rolcanlogin, r.rolsuper, r.rolcreatedb, r.rolcreaterole, r.rolconnlimit, r.rolvaliduntil
+ORDER BY r.rolname`
+
+func runPgsqlUsers(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(dbCtx, pgUsersQuery)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tLOGIN\tSUPERUSER\tCREATEDB\tCREATEROLE\tCONN_LIMIT\tVALID_UNTIL\tMEMBER_OF")
+	for rows.Next() {
+		var name string
+		var login, super, createDB, createRole bool
+		var connLimit int
+		var validUntil string
+		var memberOf pq.StringArray
+		if err := rows.Scan(&name, &login, &super, &createDB, &createRole, &connLimit, &validUntil, &memberOf); err != nil {
+			return err
+		}
+		limit := "-"
+		if connLimit >= 0 {
+			limit = strconv.Itoa(connLimit)
+		}
+		member := "-"
+		if len(memberOf) > 0 {
+			member = strings.Join(memberOf, ",")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, yesNo(login), yesNo(super), yesNo(createDB),
+			yesNo(createRole), limit, validUntil, member)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	pgSchemaOwner      string
+	pgSchemaCascade    bool
+	pgSchemaPreset     string
+	pgSchemaForRoles   []string
+	pgTablesSchemaName string
+)
+
+var (
+	pgsqlSchemasCmd = &cobra.Command{
+		Use:   "schemas [database]",
+		Short: "List schemas in a database with owner and table count",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlSchemas,
+	}
+	pgsqlCreateSchemaCmd = &cobra.Command{
+		Use:   "create-schema [database] [schema]",
+		Short: "Create a schema in a database",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlCreateSchema,
+	}
+	pgsqlDropSchemaCmd = &cobra.Command{
+		Use:   "drop-schema [database] [schema]",
+		Short: "Drop a schema (with confirmation)",
+		Args:  cobra.ExactArgs(2),
+		RunE:  runPgsqlDropSchema,
+	}
+	pgsqlGrantSchemaCmd = &cobra.Command{
+		Use:   "grant-schema [database] [schema] [username]",
+		Short: "Grant a preset on a schema, its objects and future objects (ALTER DEFAULT PRIVILEGES)",
+		Long: `Grants the preset on the schema and on all existing tables, sequences and functions in it,
+then sets default privileges so tables created later are covered too.
+
+Default privileges only apply to objects created by the roles given with --for-role
+(default: the schema owner).`,
+		Args: cobra.ExactArgs(3),
+		RunE: runPgsqlGrantSchema,
+	}
+)
+
+func init() {
+	pgsqlCreateSchemaCmd.Flags().StringVar(&pgSchemaOwner, "owner", "", "schema owner (default: connecting user)")
+	pgsqlDropSchemaCmd.Flags().BoolVar(&pgSchemaCascade, "cascade", false, "also drop all objects in the schema")
+	pgsqlGrantSchemaCmd.Flags().StringVar(&pgSchemaPreset, "preset", presetOwner, "privilege preset: readonly, readwrite, ddl or owner")
+	pgsqlGrantSchemaCmd.Flags().StringSliceVar(&pgSchemaForRoles, "for-role", nil, "roles whose future objects get default privileges (default: schema owner)")
+	pgsqlTablesCmd.Flags().StringVar(&pgTablesSchemaName, "schema", "", "only tables in this schema (default: all non-system schemas)")
+	pgsqlCmd.AddCommand(pgsqlSchemasCmd, pgsqlCreateSchemaCmd, pgsqlDropSchemaCmd, pgsqlGrantSchemaCmd)
+}
+
+// openPgDatabase validates database and connects to it.
+func openPgDatabase(database string) (*sql.DB, error) {
+	if err := requireSafeIdent(database, "database"); err != nil {
+		return nil, err
+	}
+	cfg := getPgConfig()
+	cfg.Database = database
+	return openPg(cfg)
+}
+
+func pgSchemaExists(conn *sql.DB, schema string) (bool, error) {
+	var exists int
+	err := conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_namespace WHERE nspname = $1", schema).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// pgDefaultPrivilegeStatements returns ALTER DEFAULT PRIVILEGES statements giving user the preset on
+// future tables, sequences and functions that forRole creates in schema.
+func pgDefaultPrivilegeStatements(preset, schema, user, forRole string) []string {
+	p := pgPresets[preset]
+	prefix := `ALTER DEFAULT PRIVILEGES FOR ROLE "` + forRole + `" IN SCHEMA "` + schema + `" GRANT `
+	to := ` TO "` + user + `"`
+	stmts := []string{
+		prefix + p.tables + " ON TABLES" + to,
+		prefix + p.sequences + " ON SEQUENCES" + to,
+	}
+	if p.functions != "" {
+		stmts = append(stmts, prefix+p.functions+" ON FUNCTIONS"+to)
+	}
+	return stmts
+}
+
+func runPgsqlSchemas(cmd *cobra.Command, args []string) error {
+	conn, err := openPgDatabase(args[0])
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(dbCtx, `SELECT n.nspname, pg_get_userbyid(n.nspowner),
+		(SELECT COUNT(*) FROM pg_tables t WHERE t.schemaname = n.nspname)
+		FROM pg_namespace n
+		WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema'
+		ORDER BY n.nspname`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SCHEMA\tOWNER\tTABLES")
+	for rows.Next() {
+		var name, owner string
+		var tables int64
+		if err := rows.Scan(&name, &owner, &tables); err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\n", name, owner, tables)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func runPgsqlCreateSchema(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[1], "schema"); err != nil {
+		return err
+	}
+	if pgSchemaOwner != "" {
+		if err := requireSafeIdent(pgSchemaOwner, "owner"); err != nil {
+			return err
+		}
+	}
+	database, schema := args[0], args[1]
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := pgSchemaExists(conn, schema)
+	if err != nil {
+		return err
+	}
+	if exists {
+		fmt.Println("Schema '" + schema + "' already exists in '" + database + "'.")
+		return nil
+	}
+	q := `CREATE SCHEMA "` + schema + `"`
+	if pgSchemaOwner != "" {
+		q += ` AUTHORIZATION "` + pgSchemaOwner + `"`
+	}
+	if err := execSQL(conn, q); err != nil {
+		return err
+	}
+	fmt.Println("Schema '" + schema + "' created in '" + database + "'.")
+	return nil
+}
+
+func runPgsqlDropSchema(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[1], "schema"); err != nil {
+		return err
+	}
+	database, schema := args[0], args[1]
+	if err := guardDrop("schema", schema, pgSystemSchemas[schema] || strings.HasPrefix(schema, "pg_")); err != nil {
+		return err
+	}
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := pgSchemaExists(conn, schema)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		fmt.Println("Schema '" + schema + "' does not exist in '" + database + "'.")
+		return nil
+	}
+	var tables int64
+	if err := conn.QueryRowContext(dbCtx, "SELECT COUNT(*) FROM pg_tables WHERE schemaname = $1", schema).Scan(&tables); err != nil {
+		return err
+	}
+	if tables > 0 && !pgSchemaCascade {
+		return fmt.Errorf("schema '%s' contains %d table(s); pass --cascade to drop them too", schema, tables)
+	}
+	if !confirm("Type schema name to confirm: ", schema) {
+		return cancelled()
+	}
+	q := `DROP SCHEMA "` + schema + `"`
+	if pgSchemaCascade {
+		q += " CASCADE"
+	}
+	if err := execSQL(conn, q); err != nil {
+		return err
+	}
+	fmt.Println("Schema deleted.")
+	return nil
+}
+
+func runPgsqlGrantSchema(cmd *cobra.Command, args []string) error {
+	if err := requireSafeIdent(args[0], "database"); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[1], "schema"); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[2], "username"); err != nil {
+		return err
+	}
+	if err := checkPreset(pgSchemaPreset); err != nil {
+		return err
+	}
+	for _, r := range pgSchemaForRoles {
+		if err := requireSafeIdent(r, "role"); err != nil {
+			return err
+		}
+	}
+	database, schema, username := args[0], args[1], args[2]
+	conn, err := openPgDatabase(database)
+	if err != nil {
+		return err
+	}
+	var owner string
+	err = conn.QueryRowContext(dbCtx, "SELECT pg_get_userbyid(nspowner) FROM pg_namespace WHERE nspname = $1", schema).Scan(&owner)
+	conn.Close()
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("schema '%s' does not exist in '%s'", schema, database)
+	}
+	if err != nil {
+		return err
+	}
+	forRoles := pgSchemaForRoles
+	if len(forRoles) == 0 {
+		forRoles = []string{owner}
+	}
+
+	_, schemaLevel := pgPresetStatements(pgSchemaPreset, database, schema, username, false)
+	// Only CONNECT is needed at database level to reach the schema; the preset's database privileges
+	// belong to plain grant.
+	dbLevel := []string{`GRANT CONNECT ON DATABASE "` + database + `" TO "` + username + `"`}
+	for _, r := range forRoles {
+		schemaLevel = append(schemaLevel, pgDefaultPrivilegeStatements(pgSchemaPreset, schema, username, r)...)
+	}
+	if err := runPgPresetStatements(database, dbLevel, schemaLevel); err != nil {
+		return err
+	}
+	fmt.Printf("Granted %s on schema '%s' to '%s' (default privileges for %s).\n", pgSchemaPreset, schema, username, strings.Join(forRoles, ", "))
+	return nil
+}
@@ -0,0 +1,181 @@
+package cmd
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/config"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var rotateWriteEnv string
+
+var (
+	mysqlRotatePasswordCmd = &cobra.Command{
+		Use:   "rotate-password [username]",
+		Short: "Set a new generated password for a MySQL user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMysqlRotatePassword,
+	}
+	pgsqlRotatePasswordCmd = &cobra.Command{
+		Use:   "rotate-password [username]",
+		Short: "Set a new generated password for a PostgreSQL user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runPgsqlRotatePassword,
+	}
+	mongoRotatePasswordCmd = &cobra.Command{
+		Use:   "rotate-password [username]",
+		Short: "Set a new generated password for a MongoDB user",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runMongoRotatePassword,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{mysqlRotatePasswordCmd, pgsqlRotatePasswordCmd, mongoRotatePasswordCmd} {
+		c.Flags().StringVar(&rotateWriteEnv, "write-env", "", "also store the new password as KEY in the project's .env file")
+	}
+	mysqlCmd.AddCommand(mysqlRotatePasswordCmd)
+	pgsqlCmd.AddCommand(pgsqlRotatePasswordCmd)
+	mongoCmd.AddCommand(mongoRotatePasswordCmd)
+}
+
+// envKey is a variable name that can be written to .env as is.
+var envKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// requireEnvKey checks --write-env before the password is changed, so a bad key cannot fail the write afterwards.
+func requireEnvKey() error {
+	if rotateWriteEnv != "" && !envKey.MatchString(rotateWriteEnv) {
+		return fmt.Errorf("invalid --write-env key %q (letters, digits and underscore, not starting with a digit)", rotateWriteEnv)
+	}
+	return nil
+}
+
+// printRotatedPassword reports the new password and writes it to .env when --write-env is set.
+func printRotatedPassword(username, pw string) error {
+	fmt.Println("User:", username)
+	fmt.Println("Password:", pw)
+	if rotateWriteEnv == "" {
+		fmt.Println("Save this password.")
+		return nil
+	}
+	path := config.FindEnvFile()
+	if path == "" {
+		path = ".env"
+	}
+	if exec.DryRun {
+		fmt.Println("[dry-run] set", rotateWriteEnv, "in", path)
+		return nil
+	}
+	if err := config.SetEnvValue(path, rotateWriteEnv, pw); err != nil {
+		return fmt.Errorf("password changed but writing %s failed: %w", path, err)
+	}
+	fmt.Println("Updated", rotateWriteEnv, "in", path)
+	return nil
+}
+
+func runMysqlRotatePassword(cmd *cobra.Command, args []string) error {
+	if err := requireEnvKey(); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	if err := requireAccountHost(mysqlAccountHost); err != nil {
+		return err
+	}
+	username := args[0]
+	pw := genPassword()
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	exists, err := mysqlUserExists(conn, username, mysqlAccountHost)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return noop("User '" + username + "@" + mysqlAccountHost + "' does not exist.")
+	}
+	pwEsc := strings.ReplaceAll(pw, "'", "''")
+	err = execSQL(conn, "ALTER USER "+mysqlAccount(username, mysqlAccountHost)+" IDENTIFIED BY '"+pwEsc+"'")
+	if err != nil {
+		return err
+	}
+	return printRotatedPassword(username, pw)
+}
+
+func runPgsqlRotatePassword(cmd *cobra.Command, args []string) error {
+	if err := requireEnvKey(); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	username := args[0]
+	pw := genPassword()
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var exists int
+	err = conn.QueryRowContext(dbCtx, "SELECT 1 FROM pg_roles WHERE rolname = $1", username).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return noop("User '" + username + "' does not exist.")
+	}
+	if err != nil {
+		return err
+	}
+	pwEsc := strings.ReplaceAll(pw, "'", "''")
+	err = execSQL(conn, `ALTER USER "`+username+`" WITH PASSWORD '`+pwEsc+`'`)
+	if err != nil {
+		return err
+	}
+	return printRotatedPassword(username, pw)
+}
+
+func runMongoRotatePassword(cmd *cobra.Command, args []string) error {
+	if err := requireEnvKey(); err != nil {
+		return err
+	}
+	if err := requireSafeIdent(args[0], "username"); err != nil {
+		return err
+	}
+	username := args[0]
+	pw := genPassword()
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+
+	admin := client.Database("admin")
+	var u bson.M
+	err = admin.RunCommand(ctx, bson.D{{Key: "usersInfo", Value: username}}).Decode(&u)
+	if err != nil {
+		return err
+	}
+	if users, ok := u["users"].(bson.A); !ok || len(users) == 0 {
+		return noop("User '" + username + "' does not exist.")
+	}
+	cmdDoc := bson.D{
+		{Key: "updateUser", Value: username},
+		{Key: "pwd", Value: pw},
+	}
+	if err := runMongoCommand(ctx, mongoDriver{client}, "admin", cmdDoc); err != nil {
+		return err
+	}
+	return printRotatedPassword(username, pw)
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sichang824/awesome-shell/internal/config"
+	"github.com/sichang824/awesome-shell/internal/tunnel"
+)
+
+var dbSSHTarget, dbSSHKey, dbSSHKnownHosts string
+
+// mysqlSSHNet is the network name the MySQL driver dials through the tunnel.
+const mysqlSSHNet = "ssh-tunnel"
+
+var (
+	dbTunnelMu sync.Mutex
+	dbTunnel   *tunnel.Tunnel
+)
+
+func init() {
+	f := dbCmd.PersistentFlags()
+	f.StringVar(&dbSSHTarget, "ssh", "", "connect through this bastion: user@host[:port] (default from DB_SSH env)")
+	f.StringVar(&dbSSHKey, "ssh-key", "", "private key for --ssh (default from DB_SSH_KEY env, else ssh-agent and ~/.ssh/id_*)")
+	f.StringVar(&dbSSHKnownHosts, "ssh-known-hosts", "", "known_hosts file that verifies the bastion (default ~/.ssh/known_hosts)")
+}
+
+// sshTunnel returns the bastion tunnel shared by every connection of this run, or nil without --ssh.
+// Database hosts are then resolved and dialed from the bastion.
+func sshTunnel() (*tunnel.Tunnel, error) {
+	target := dbSSHTarget
+	if target == "" {
+		target = config.GetEnv("DB_SSH", "")
+	}
+	if target == "" {
+		return nil, nil
+	}
+	dbTunnelMu.Lock()
+	defer dbTunnelMu.Unlock()
+	if dbTunnel == nil {
+		key := dbSSHKey
+		if key == "" {
+			key = config.GetEnv("DB_SSH_KEY", "")
+		}
+		t, err := tunnel.Open(tunnel.Options{Target: target, KeyFile: key, KnownHosts: dbSSHKnownHosts, Timeout: dbConnectTimeout})
+		if err != nil {
+			return nil, err
+		}
+		dbTunnel = t
+	}
+	return dbTunnel, nil
+}
+
+// toolAddress returns the host and port an external client (pg_dump, pg_restore) should use for host:port,
+// forwarding a local port through the bastion when --ssh is set. Close the returned closer once the client exits.
+func toolAddress(host, port string) (string, string, io.Closer, error) {
+	t, err := sshTunnel()
+	if err != nil || t == nil {
+		return host, port, io.NopCloser(nil), err
+	}
+	local, closer, err := t.Forward(net.JoinHostPort(host, port))
+	if err != nil {
+		return "", "", nil, err
+	}
+	host, port, err = net.SplitHostPort(local)
+	if err != nil {
+		closer.Close()
+		return "", "", nil, err
+	}
+	return host, port, closer, nil
+}
+
+// dialMySQLTunnel adapts the tunnel to the MySQL driver's dial hook.
+func dialMySQLTunnel(t *tunnel.Tunnel) func(ctx context.Context, addr string) (net.Conn, error) {
+	return func(ctx context.Context, addr string) (net.Conn, error) {
+		return t.DialContext(ctx, "tcp", addr)
+	}
+}
@@ -0,0 +1,363 @@
+package cmd
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	statsSort  string
+	statsLimit int
+	statsJSON  bool
+)
+
+// dbStat is one line of a size report: a database, or a table/collection within one.
+type dbStat struct {
+	Name        string     `json:"name"`
+	DataBytes   int64      `json:"data_bytes"`
+	IndexBytes  int64      `json:"index_bytes"`
+	Rows        int64      `json:"rows"`
+	Tables      int64      `json:"tables,omitempty"`
+	LastVacuum  *time.Time `json:"last_vacuum,omitempty"`
+	LastAnalyze *time.Time `json:"last_analyze,omitempty"`
+	// Unavailable marks a database whose tables could not be read; only its total size is known.
+	Unavailable bool `json:"unavailable,omitempty"`
+}
+
+// dbStatsReport is the --json form, stamped so successive runs can be compared.
+type dbStatsReport struct {
+	Engine      string    `json:"engine"`
+	Server      string    `json:"server"`
+	Database    string    `json:"database,omitempty"`
+	CollectedAt time.Time `json:"collected_at"`
+	Items       []dbStat  `json:"items"`
+}
+
+var (
+	mysqlStatsCmd = &cobra.Command{
+		Use:   "stats [database]",
+		Short: "Size and row-count report per database, or per table with [database]",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runMysqlStats,
+	}
+	pgsqlStatsCmd = &cobra.Command{
+		Use:   "stats [database]",
+		Short: "Size, row-count and vacuum/analyze report per database, or per table with [database]",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runPgsqlStats,
+	}
+	mongoStatsCmd = &cobra.Command{
+		Use:   "stats [database]",
+		Short: "Size and document-count report per database, or per collection with [database]",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  runMongoStats,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{mysqlStatsCmd, pgsqlStatsCmd, mongoStatsCmd} {
+		c.Flags().StringVar(&statsSort, "sort", "size", "sort by size, index, rows or name")
+		c.Flags().IntVar(&statsLimit, "limit", 0, "show only the top N entries (0 = all)")
+		c.Flags().BoolVar(&statsJSON, "json", false, "print the report as JSON")
+	}
+	mysqlCmd.AddCommand(mysqlStatsCmd)
+	pgsqlCmd.AddCommand(pgsqlStatsCmd)
+	mongoCmd.AddCommand(mongoStatsCmd)
+}
+
+func sortStats(items []dbStat) error {
+	var less func(a, b dbStat) bool
+	switch statsSort {
+	case "size":
+		less = func(a, b dbStat) bool { return a.DataBytes+a.IndexBytes > b.DataBytes+b.IndexBytes }
+	case "index":
+		less = func(a, b dbStat) bool { return a.IndexBytes > b.IndexBytes }
+	case "rows":
+		less = func(a, b dbStat) bool { return a.Rows > b.Rows }
+	case "name":
+		less = func(a, b dbStat) bool { return a.Name < b.Name }
+	default:
+		return fmt.Errorf("invalid --sort %q (use size, index, rows or name)", statsSort)
+	}
+	sort.SliceStable(items, func(i, j int) bool { return less(items[i], items[j]) })
+	return nil
+}
+
+// printStats sorts, limits and prints items as a table or JSON report.
+func printStats(engine, server, database string, items []dbStat) error {
+	if err := sortStats(items); err != nil {
+		return err
+	}
+	if statsLimit > 0 && len(items) > statsLimit {
+		items = items[:statsLimit]
+	}
+	if statsJSON {
+		if items == nil {
+			items = []dbStat{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(dbStatsReport{
+			Engine:      engine,
+			Server:      server,
+			Database:    database,
+			CollectedAt: time.Now().UTC(),
+			Items:       items,
+		})
+	}
+	unit := "ROWS"
+	if engine == "mongo" {
+		unit = "DOCS"
+	}
+	vacuum := engine == "postgres" && database != ""
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	header := "NAME\tDATA\tINDEX\tTOTAL\t" + unit
+	if database == "" {
+		header += "\tTABLES"
+	}
+	if vacuum {
+		header += "\tLAST VACUUM\tLAST ANALYZE"
+	}
+	fmt.Fprintln(w, header)
+	for _, it := range items {
+		line := fmt.Sprintf("%s\t%s\t%s\t%s\t%d", it.Name, humanBytes(it.DataBytes), humanBytes(it.IndexBytes),
+			humanBytes(it.DataBytes+it.IndexBytes), it.Rows)
+		if it.Unavailable {
+			line = fmt.Sprintf("%s\t%s\t?\t%s\t?", it.Name, humanBytes(it.DataBytes), humanBytes(it.DataBytes))
+		}
+		if database == "" && it.Unavailable {
+			line += "\t?"
+		} else if database == "" {
+			line += fmt.Sprintf("\t%d", it.Tables)
+		}
+		if vacuum {
+			line += "\t" + formatStatTime(it.LastVacuum) + "\t" + formatStatTime(it.LastAnalyze)
+		}
+		fmt.Fprintln(w, line)
+	}
+	return w.Flush()
+}
+
+func formatStatTime(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func runMysqlStats(cmd *cobra.Command, args []string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	server := cfg.Host + ":" + cfg.Port
+
+	var rows *sql.Rows
+	database := ""
+	if len(args) == 1 {
+		if err := requireSafeIdent(args[0], "database"); err != nil {
+			return err
+		}
+		database = args[0]
+		rows, err = conn.QueryContext(dbCtx, `SELECT table_name, COALESCE(data_length, 0), COALESCE(index_length, 0), COALESCE(table_rows, 0), 0
+			FROM information_schema.tables WHERE table_schema = ?`, database)
+	} else {
+		rows, err = conn.QueryContext(dbCtx, `SELECT s.schema_name, COALESCE(SUM(t.data_length), 0), COALESCE(SUM(t.index_length), 0),
+			COALESCE(SUM(t.table_rows), 0), COUNT(t.table_name)
+			FROM information_schema.schemata s LEFT JOIN information_schema.tables t ON t.table_schema = s.schema_name
+			GROUP BY s.schema_name`)
+	}
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var items []dbStat
+	for rows.Next() {
+		var s dbStat
+		if err := rows.Scan(&s.Name, &s.DataBytes, &s.IndexBytes, &s.Rows, &s.Tables); err != nil {
+			return err
+		}
+		items = append(items, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return printStats("mysql", server, database, items)
+}
+
+const pgTableStatsQuery = `SELECT s.schemaname || '.' || s.relname, pg_table_size(s.relid), pg_indexes_size(s.relid),
+	CASE WHEN c.reltuples >= 0 THEN c.reltuples::bigint ELSE s.n_live_tup END,
+	GREATEST(s.last_vacuum, s.last_autovacuum), GREATEST(s.last_analyze, s.last_autoanalyze)
+FROM pg_stat_user_tables s JOIN pg_class c ON c.oid = s.relid`
+
+func pgTableStats(conn *sql.DB) ([]dbStat, error) {
+	rows, err := conn.QueryContext(dbCtx, pgTableStatsQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []dbStat
+	for rows.Next() {
+		var s dbStat
+		var vacuum, analyze sql.NullTime
+		if err := rows.Scan(&s.Name, &s.DataBytes, &s.IndexBytes, &s.Rows, &vacuum, &analyze); err != nil {
+			return nil, err
+		}
+		if vacuum.Valid {
+			s.LastVacuum = &vacuum.Time
+		}
+		if analyze.Valid {
+			s.LastAnalyze = &analyze.Time
+		}
+		items = append(items, s)
+	}
+	return items, rows.Err()
+}
+
+func runPgsqlStats(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	server := cfg.Host + ":" + cfg.Port
+	if len(args) == 1 {
+		if err := requireSafeIdent(args[0], "database"); err != nil {
+			return err
+		}
+		cfg.Database = args[0]
+		conn, err := openPg(cfg)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		items, err := pgTableStats(conn)
+		if err != nil {
+			return err
+		}
+		return printStats("postgres", server, args[0], items)
+	}
+
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	rows, err := conn.QueryContext(dbCtx, `SELECT datname, pg_database_size(datname) FROM pg_database
+		WHERE datistemplate = false AND has_database_privilege(datname, 'CONNECT') ORDER BY datname`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	var items []dbStat
+	for rows.Next() {
+		var s dbStat
+		if err := rows.Scan(&s.Name, &s.DataBytes); err != nil {
+			return err
+		}
+		items = append(items, s)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// Index sizes and row estimates live in each database's own catalog.
+	for i := range items {
+		dcfg := cfg
+		dcfg.Database = items[i].Name
+		dconn, err := openPg(dcfg)
+		var tables []dbStat
+		if err == nil {
+			tables, err = pgTableStats(dconn)
+			dconn.Close()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", items[i].Name, err)
+			items[i].Unavailable = true
+			continue
+		}
+		for _, t := range tables {
+			items[i].IndexBytes += t.IndexBytes
+			items[i].Rows += t.Rows
+			items[i].Tables++
+		}
+		items[i].DataBytes -= items[i].IndexBytes
+	}
+	return printStats("postgres", server, "", items)
+}
+
+type mongoSizeStats struct {
+	StorageSize    float64 `bson:"storageSize"`
+	IndexSize      float64 `bson:"indexSize"`
+	TotalIndexSize float64 `bson:"totalIndexSize"`
+	Objects        float64 `bson:"objects"`
+	Count          float64 `bson:"count"`
+	Collections    float64 `bson:"collections"`
+}
+
+func runMongoStats(cmd *cobra.Command, args []string) error {
+	ctx := dbCtx
+	cfg := getMongoConfig()
+	client, err := openMongo(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect(ctx)
+	server := cfg.Host + ":" + cfg.Port
+
+	var items []dbStat
+	if len(args) == 1 {
+		if err := requireSafeIdent(args[0], "database"); err != nil {
+			return err
+		}
+		database := client.Database(args[0])
+		names, err := database.ListCollectionNames(ctx, bson.D{{Key: "type", Value: "collection"}})
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			var out []struct {
+				StorageStats mongoSizeStats `bson:"storageStats"`
+			}
+			cursor, err := database.Collection(name).Aggregate(ctx, mongo.Pipeline{{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}}})
+			if err != nil {
+				return err
+			}
+			if err := cursor.All(ctx, &out); err != nil {
+				return err
+			}
+			s := dbStat{Name: name}
+			if len(out) > 0 {
+				st := out[0].StorageStats
+				s.DataBytes, s.IndexBytes, s.Rows = int64(st.StorageSize), int64(st.TotalIndexSize), int64(st.Count)
+			}
+			items = append(items, s)
+		}
+		return printStats("mongo", server, args[0], items)
+	}
+
+	list, err := client.ListDatabases(ctx, bson.M{})
+	if err != nil {
+		return err
+	}
+	for _, d := range list.Databases {
+		var st mongoSizeStats
+		if err := client.Database(d.Name).RunCommand(ctx, bson.D{{Key: "dbStats", Value: 1}}).Decode(&st); err != nil {
+			return err
+		}
+		items = append(items, dbStat{
+			Name:       d.Name,
+			DataBytes:  int64(st.StorageSize),
+			IndexBytes: int64(st.IndexSize),
+			Rows:       int64(st.Objects),
+			Tables:     int64(st.Collections),
+		})
+	}
+	return printStats("mongo", server, "", items)
+}
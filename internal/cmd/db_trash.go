@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/config"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
+	"github.com/spf13/cobra"
+)
+
+// Retention applied after every backup and by `trash purge`; "0" disables a limit.
+const (
+	trashMaxAgeEnv  = "AS_DB_TRASH_MAX_AGE"
+	trashMaxSizeEnv = "AS_DB_TRASH_MAX_SIZE"
+)
+
+var (
+	dbNoBackup                   bool
+	trashEngine, trashRestoreAs  string
+	trashOlderThan, trashMaxSize string
+	trashPurgeAll                bool
+)
+
+var (
+	dbTrashCmd = &cobra.Command{
+		Use:   "trash",
+		Short: "Backups taken automatically before delete-db and apply --prune",
+		Long: `delete-db and apply --prune dump each database into $XDG_STATE_HOME/awesome-shell/trash before dropping it
+(skip with --no-backup).
+Old backups are removed after each new one: older than ` + trashMaxAgeEnv + ` (default 30d) or beyond a total of ` + trashMaxSizeEnv + ` (default 10GiB).
+
+PostgreSQL backups and restores run pg_dump and pg_restore from this host (or from the container with
+--via-compose); they must be installed and at least the server's major version. MongoDB backups taken
+with --via-compose are mongodump archives and are restored with mongorestore, again with --via-compose.`,
+	}
+	dbTrashListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List backups in the trash",
+		Args:  cobra.NoArgs,
+		RunE:  runDBTrashList,
+	}
+	dbTrashRestoreCmd = &cobra.Command{
+		Use:   "restore [id]",
+		Short: "Recreate a dropped database from its backup (id or unique prefix)",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runDBTrashRestore,
+	}
+	dbTrashPurgeCmd = &cobra.Command{
+		Use:   "purge [id...]",
+		Short: "Remove the given backups, or those beyond the age and size limits",
+		RunE:  runDBTrashPurge,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{mysqlDeleteDBCmd, pgsqlDeleteDBCmd, mongoDeleteDBCmd, dbApplyCmd} {
+		c.Flags().BoolVar(&dbNoBackup, "no-backup", false, "drop without taking a backup into the trash first")
+	}
+	dbTrashListCmd.Flags().StringVar(&trashEngine, "engine", "", "only backups of this engine (mysql, postgres, mongo)")
+	dbTrashRestoreCmd.Flags().StringVar(&trashRestoreAs, "as", "", "restore under a different database name")
+	f := dbTrashPurgeCmd.Flags()
+	f.StringVar(&trashOlderThan, "older-than", "", "remove backups older than this (e.g. 7d, 12h; default "+trashMaxAgeEnv+" or 30d)")
+	f.StringVar(&trashMaxSize, "max-size", "", "then remove the oldest until the trash fits (e.g. 2GiB; default "+trashMaxSizeEnv+" or 10GiB)")
+	f.BoolVar(&trashPurgeAll, "all", false, "remove every backup")
+	dbTrashCmd.AddCommand(dbTrashListCmd, dbTrashRestoreCmd, dbTrashPurgeCmd)
+	dbCmd.AddCommand(dbTrashCmd)
+}
+
+// parseAge accepts Go durations plus a d (day) suffix; 0 means no limit.
+func parseAge(s string) (time.Duration, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid age %q (e.g. 30d, 12h)", s)
+}
+
+// parseSize accepts a byte count with an optional KB/MB/GB/TB or KiB/MiB/GiB/TiB suffix; 0 means no limit.
+func parseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+		{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12}, {"B", 1},
+	}
+	num, mult := strings.TrimSpace(s), int64(1)
+	for _, u := range units {
+		if n, ok := strings.CutSuffix(num, u.suffix); ok {
+			num, mult = strings.TrimSpace(n), u.mult
+			break
+		}
+	}
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("invalid size %q (e.g. 500MiB, 10GB)", s)
+	}
+	return int64(f * float64(mult)), nil
+}
+
+// trashRetention resolves the age and size limits from flags, then the environment, then the defaults.
+func trashRetention(age, size string) (time.Duration, int64, error) {
+	if age == "" {
+		age = config.GetEnv(trashMaxAgeEnv, "30d")
+	}
+	if size == "" {
+		size = config.GetEnv(trashMaxSizeEnv, "10GiB")
+	}
+	maxAge, err := parseAge(age)
+	if err != nil {
+		return 0, 0, err
+	}
+	maxSize, err := parseSize(size)
+	return maxAge, maxSize, err
+}
+
+// backupToTrash dumps database into a new trash entry before it is dropped, then applies the retention limits.
+func backupToTrash(engine, database, file string, dump func(e *trash.Entry) error) error {
+	if exec.DryRun {
+		fmt.Println("[dry-run] back up '" + database + "' to " + trash.Dir())
+		return nil
+	}
+	e, err := trash.New(engine, engineServer(engine), database, file)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Backing up '" + database + "' to the trash...")
+	err = dump(&e)
+	if err == nil {
+		err = trash.Save(&e)
+	}
+	if err != nil {
+		_ = trash.Remove(e)
+		return fmt.Errorf("backup failed, nothing dropped (use --no-backup to drop anyway): %w", err)
+	}
+	fmt.Printf("Backup %s saved (%s). Undo with: as db trash restore %s\n", e.ID, humanBytes(e.Size), e.ID)
+	applyTrashRetention(e.ID)
+	return nil
+}
+
+// applyTrashRetention removes expired backups other than keep; failures are only warnings.
+func applyTrashRetention(keep string) {
+	maxAge, maxSize, err := trashRetention("", "")
+	if err == nil {
+		var entries []trash.Entry
+		if entries, err = trash.List(); err == nil {
+			for _, e := range trash.Expired(entries, maxAge, maxSize) {
+				if e.ID == keep {
+					continue
+				}
+				if err = trash.Remove(e); err != nil {
+					break
+				}
+				fmt.Println("Removed expired backup", e.ID)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "warning: trash retention:", err)
+	}
+}
+
+func runDBTrashList(cmd *cobra.Command, args []string) error {
+	entries, err := trash.List()
+	if err != nil {
+		return err
+	}
+	var total int64
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tENGINE\tSERVER\tDATABASE\tSIZE")
+	for _, e := range entries {
+		if trashEngine != "" && e.Engine != trashEngine {
+			continue
+		}
+		total += e.Size
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.Engine, e.Server,
+			e.Database, humanBytes(e.Size))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Println("Total:", humanBytes(total), "in", trash.Dir())
+	return nil
+}
+
+func runDBTrashRestore(cmd *cobra.Command, args []string) error {
+	e, err := trash.Find(args[0])
+	if err != nil {
+		return err
+	}
+	name := e.Database
+	if trashRestoreAs != "" {
+		name = trashRestoreAs
+	}
+	if err := requireSafeIdent(name, "database"); err != nil {
+		return err
+	}
+	if server := engineServer(e.Engine); server != e.Server {
+		fmt.Println("Note: backup was taken on " + e.Server + ", restoring to " + server + ".")
+	}
+	if exec.DryRun {
+		fmt.Println("[dry-run] restore " + e.ID + " as database '" + name + "'")
+		return nil
+	}
+	switch e.Engine {
+	case "mysql":
+		err = restoreMySQLTrash(e, name)
+	case "postgres":
+		err = restorePgTrash(e, name)
+	case "mongo":
+		err = restoreMongoTrash(e, name)
+	default:
+		err = fmt.Errorf("unknown engine %q in %s", e.Engine, e.ID)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("Database '" + name + "' restored from " + e.ID + ".")
+	return nil
+}
+
+func runDBTrashPurge(cmd *cobra.Command, args []string) error {
+	var remove []trash.Entry
+	switch {
+	case len(args) > 0:
+		for _, id := range args {
+			e, err := trash.Find(id)
+			if err != nil {
+				return err
+			}
+			remove = append(remove, e)
+		}
+	default:
+		entries, err := trash.List()
+		if err != nil {
+			return err
+		}
+		if trashPurgeAll {
+			remove = entries
+			break
+		}
+		maxAge, maxSize, err := trashRetention(trashOlderThan, trashMaxSize)
+		if err != nil {
+			return err
+		}
+		remove = trash.Expired(entries, maxAge, maxSize)
+	}
+	if len(remove) == 0 {
+		return noop("Nothing to purge.")
+	}
+	var size int64
+	for _, e := range remove {
+		fmt.Printf("  %s (%s)\n", e.ID, humanBytes(e.Size))
+		size += e.Size
+	}
+	if !confirm(fmt.Sprintf("%d backup(s), %s will be deleted. Type 'purge' to confirm: ", len(remove), humanBytes(size)), "purge") {
+		return cancelled()
+	}
+	for _, e := range remove {
+		if exec.DryRun {
+			fmt.Println("[dry-run] remove", e.ID)
+			continue
+		}
+		if err := trash.Remove(e); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Purged %d backup(s).\n", len(remove))
+	return nil
+}
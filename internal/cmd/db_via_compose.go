@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/composeexec"
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"github.com/sichang824/awesome-shell/internal/trash"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var dbViaCompose string
+
+func init() {
+	dbCmd.PersistentFlags().StringVar(&dbViaCompose, "via-compose", "", "run through docker compose exec in this service with its mysql/psql/mongosh client, for stacks that publish no port")
+}
+
+// openComposeSQL opens a database/sql handle whose statements run with the engine's client in the --via-compose service.
+func openComposeSQL(engine, user, password, database string) *sql.DB {
+	return sql.OpenDB(composeexec.NewConnector(composeexec.Config{
+		Service: dbViaCompose, Engine: engine, User: user, Password: password, Database: database,
+	}))
+}
+
+// errMongoViaCompose is returned by MongoDB subcommands that --via-compose does not cover.
+var errMongoViaCompose = errors.New("--via-compose supports create-db, create-user, delete-db, delete-user, grant, dbs, users, collections and client for MongoDB")
+
+// refuseViaCompose fails a command that needs one session for several statements, which --via-compose
+// cannot keep: every statement runs in a new client there.
+func refuseViaCompose(command string) error {
+	if dbViaCompose == "" {
+		return nil
+	}
+	return fmt.Errorf("%s does not work with --via-compose, which runs every statement in a new client session; publish the database port or use --ssh", command)
+}
+
+// composeMongoServer is a mongoServer that runs every command with mongosh in the --via-compose service.
+type composeMongoServer struct {
+	m *composeexec.Mongo
+}
+
+func composeMongo(user, password string) composeMongoServer {
+	return composeMongoServer{composeexec.NewMongo(composeexec.Config{Service: dbViaCompose, User: user, Password: password})}
+}
+
+func (s composeMongoServer) RunCommand(_ context.Context, database string, cmd bson.D, result any) error {
+	return s.m.RunCommand(database, cmd, result)
+}
+
+func (s composeMongoServer) Each(_ context.Context, database string, cmd bson.D, fn func(bson.Raw) error) error {
+	return s.m.Each(database, cmd, fn)
+}
+
+func (s composeMongoServer) Disconnect(context.Context) error {
+	return nil
+}
+
+// composeMongoTool runs the MongoDB tool named by $0 in the service with the credentials of the environment;
+// the shell puts the password on the tool's command line inside the container only.
+const composeMongoTool = `if [ -n "$AS_MONGO_USER" ]; then
+  set -- --username="$AS_MONGO_USER" --password="$AS_MONGO_PASSWORD" --authenticationDatabase=admin "$@"
+fi
+exec "$0" "$@"`
+
+// composeMongoEnv passes the MongoDB credentials to mongosh and composeMongoTool.
+func composeMongoEnv(user, password string) map[string]string {
+	return map[string]string{"AS_MONGO_USER": user, "AS_MONGO_PASSWORD": password}
+}
+
+// composeMongoAuth logs the interactive mongosh in with the credentials passed in its environment.
+const composeMongoAuth = `if (process.env.AS_MONGO_USER) db.getSiblingDB('admin').auth(process.env.AS_MONGO_USER, process.env.AS_MONGO_PASSWORD)`
+
+// runComposeClient starts the engine's interactive client in the --via-compose service; passwords go through the environment.
+func runComposeClient(engine, user, password, database string) error {
+	switch engine {
+	case "mysql":
+		args := []string{"mysql", "-u", user}
+		if database != "" {
+			args = append(args, "-D", database)
+		}
+		return exec.DockerComposeExecTTYWithEnv(dbViaCompose, map[string]string{"MYSQL_PWD": password}, args...)
+	case "postgres":
+		return exec.DockerComposeExecTTYWithEnv(dbViaCompose, map[string]string{"PGPASSWORD": password}, "psql", "-U", user, "-d", database)
+	}
+	return exec.DockerComposeExecTTYWithEnv(dbViaCompose, composeMongoEnv(user, password),
+		"mongosh", "--quiet", "--shell", "--eval", composeMongoAuth)
+}
+
+// dumpComposeMySQL writes database to e's dump file with mysqldump in the --via-compose service.
+func dumpComposeMySQL(user, password, database string, e *trash.Entry) error {
+	return writeComposeDump(e, "mysqldump", true, map[string]string{"MYSQL_PWD": password},
+		"mysqldump", "-u", user, "--single-transaction", "--routines", "--triggers", "--events", "--hex-blob",
+		"--default-character-set=utf8mb4", database)
+}
+
+// dumpComposePg writes database to e's dump file with pg_dump -Fc in the --via-compose service.
+func dumpComposePg(user, password, database string, e *trash.Entry) error {
+	return writeComposeDump(e, "pg_dump", false, map[string]string{"PGPASSWORD": password}, "pg_dump", "-U", user, "-Fc", database)
+}
+
+// dumpComposeMongo writes database to e's dump file as a mongodump archive from the --via-compose service.
+func dumpComposeMongo(user, password, database string, e *trash.Entry) error {
+	return writeComposeDump(e, "mongodump", true, composeMongoEnv(user, password),
+		"sh", "-c", composeMongoTool, "mongodump", "--archive", "--db="+database)
+}
+
+// writeComposeDump runs args in the --via-compose service into e's dump file; tool names it in errors.
+func writeComposeDump(e *trash.Entry, tool string, compress bool, env map[string]string, args ...string) error {
+	f, err := os.OpenFile(e.Path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var stderr bytes.Buffer
+	if !compress {
+		if err := exec.DockerComposeExecIOReadOnly(dbViaCompose, env, nil, f, &stderr, args...); err != nil {
+			return fmt.Errorf("%s: %w %s", tool, err, strings.TrimSpace(stderr.String()))
+		}
+		return f.Close()
+	}
+	zw := gzip.NewWriter(f)
+	if err := exec.DockerComposeExecIOReadOnly(dbViaCompose, env, nil, zw, &stderr, args...); err != nil {
+		return fmt.Errorf("%s: %w %s", tool, err, strings.TrimSpace(stderr.String()))
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// restoreComposeDump feeds e's dump file to a client in the --via-compose service; gzip files are decompressed first.
+func restoreComposeDump(e trash.Entry, env map[string]string, args ...string) error {
+	f, err := os.Open(e.Path())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var in io.Reader = f
+	if strings.HasSuffix(e.File, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		in = zr
+	}
+	return exec.DockerComposeExecIO(dbViaCompose, env, in, os.Stdout, os.Stderr, args...)
+}
+
+// restoreComposeMongo loads the mongodump archive of e into database name with mongorestore in the
+// --via-compose service. Backups of either kind are only restored the way they were taken.
+func restoreComposeMongo(e trash.Entry, user, password, name string) error {
+	if dbViaCompose == "" {
+		return fmt.Errorf("backup %s was taken with mongodump through --via-compose; restore it with --via-compose", e.ID)
+	}
+	if e.File != mongoArchiveFile {
+		return fmt.Errorf("backup %s was taken through a direct connection; restore it without --via-compose", e.ID)
+	}
+	if exists, err := mongoDBExists(dbCtx, composeMongo(user, password), name); err != nil {
+		return err
+	} else if exists {
+		return fmt.Errorf("database '%s' already exists; pick another name with --as", name)
+	}
+	if err := restoreComposeDump(e, composeMongoEnv(user, password), "sh", "-c", composeMongoTool, "mongorestore", "--archive",
+		"--nsInclude="+e.Database+".*", "--nsFrom="+e.Database+".*", "--nsTo="+name+".*"); err != nil {
+		return fmt.Errorf("mongorestore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	waitTimeout, waitInterval time.Duration
+	waitQuiet                 bool
+)
+
+const waitLong = `Poll the server until it accepts the configured credentials and answers a
+trivial query (SELECT 1, or ping for MongoDB). The delay between attempts
+starts at --interval and backs off up to 8x that value.
+
+Exit status: 0 when ready, 2 when --timeout expires, 1 on other errors.`
+
+var (
+	mysqlWaitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait until MySQL accepts connections (for compose startups)",
+		Long:  waitLong,
+		Args:  cobra.NoArgs,
+		RunE:  runMysqlWait,
+	}
+	pgsqlWaitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait until PostgreSQL accepts connections (for compose startups)",
+		Long:  waitLong,
+		Args:  cobra.NoArgs,
+		RunE:  runPgsqlWait,
+	}
+	mongoWaitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait until MongoDB accepts connections (for compose startups)",
+		Long:  waitLong,
+		Args:  cobra.NoArgs,
+		RunE:  runMongoWait,
+	}
+)
+
+func init() {
+	for _, c := range []*cobra.Command{mysqlWaitCmd, pgsqlWaitCmd, mongoWaitCmd} {
+		// A timeout is an expected outcome in scripts; keep stderr to the error line.
+		c.SilenceUsage = true
+		c.Flags().DurationVar(&waitTimeout, "timeout", 60*time.Second, "give up after this long")
+		c.Flags().DurationVar(&waitInterval, "interval", time.Second, "initial delay between attempts")
+		c.Flags().BoolVarP(&waitQuiet, "quiet", "q", false, "do not print failed attempts")
+	}
+	mysqlCmd.AddCommand(mysqlWaitCmd)
+	pgsqlCmd.AddCommand(pgsqlWaitCmd)
+	mongoCmd.AddCommand(mongoWaitCmd)
+}
+
+// waitReady calls probe until it succeeds or --timeout expires. Each attempt gets its own deadline
+// so a connection that hangs during server startup cannot eat the whole budget.
+func waitReady(engine, addr string, probe func(ctx context.Context) error) error {
+	if waitInterval <= 0 {
+		return fmt.Errorf("--interval must be positive")
+	}
+	start := time.Now()
+	deadline := start.Add(waitTimeout)
+	delay := waitInterval
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		perAttempt := 5 * time.Second
+		if waitInterval > perAttempt {
+			perAttempt = waitInterval
+		}
+		if perAttempt > remaining {
+			perAttempt = remaining
+		}
+		ctx, cancel := context.WithTimeout(dbCtx, perAttempt)
+		lastErr = probe(ctx)
+		cancel()
+		if lastErr == nil {
+			fmt.Printf("%s at %s is ready (after %s).\n", engine, addr, time.Since(start).Round(100*time.Millisecond))
+			return nil
+		}
+		if !waitQuiet {
+			fmt.Fprintf(os.Stderr, "attempt %d: %s at %s not ready: %v\n", attempt, engine, addr, lastErr)
+		}
+		if time.Until(deadline) <= delay {
+			break
+		}
+		select {
+		case <-dbCtx.Done():
+			return dbCtx.Err()
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > 8*waitInterval {
+			delay = 8 * waitInterval
+		}
+	}
+	err := fmt.Errorf("timed out after %s waiting for %s at %s", waitTimeout, engine, addr)
+	if lastErr != nil {
+		err = fmt.Errorf("%w: last error: %v", err, lastErr)
+	}
+	return &exitError{code: 2, err: err}
+}
+
+func runMysqlWait(cmd *cobra.Command, args []string) error {
+	cfg := getMySQLConfig()
+	conn, err := openMySQL(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return waitReady("mysql", cfg.Host+":"+cfg.Port, func(ctx context.Context) error {
+		var one int
+		return conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+}
+
+func runPgsqlWait(cmd *cobra.Command, args []string) error {
+	cfg := getPgConfig()
+	conn, err := openPg(cfg)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return waitReady("postgres", cfg.Host+":"+cfg.Port, func(ctx context.Context) error {
+		var one int
+		return conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+	})
+}
+
+func runMongoWait(cmd *cobra.Command, args []string) error {
+	cfg := getMongoConfig()
+	return waitReady("mongo", cfg.Host+":"+cfg.Port, func(ctx context.Context) error {
+		client, err := openMongo(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		return client.Disconnect(context.Background())
+	})
+}
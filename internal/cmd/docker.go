@@ -27,7 +27,7 @@ func init() {
 }
 
 func runDockerRmNone(cmd *cobra.Command, args []string) error {
-	out, _, err := exec.Run("docker", "images", "-f", "dangling=true", "-q")
+	out, _, err := exec.RunReadOnly("docker", "images", "-f", "dangling=true", "-q")
 	if err != nil {
 		return err
 	}
@@ -37,7 +37,7 @@ func runDockerRmNone(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 	fmt.Println("Found dangling images:")
-	listOut, _, _ := exec.Run("docker", "images", "-f", "dangling=true")
+	listOut, _, _ := exec.RunReadOnly("docker", "images", "-f", "dangling=true")
 	fmt.Print(listOut)
 	fmt.Print("Remove these images? (y/n): ")
 	scanner := bufio.NewScanner(os.Stdin)
@@ -45,8 +45,7 @@ func runDockerRmNone(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 	if strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
-		fmt.Println("Cancelled.")
-		return nil
+		return cancelled()
 	}
 	args = append([]string{"rmi"}, ids...)
 	_, stderr, err := exec.Run("docker", args...)
@@ -47,8 +47,7 @@ func runInstall(cmd *cobra.Command, args []string) error {
 					return nil
 				}
 				if strings.ToLower(strings.TrimSpace(scanner.Text())) != "y" {
-					fmt.Println("Cancelled.")
-					return nil
+					return cancelled()
 				}
 			}
 			if err := os.RemoveAll(dest); err != nil {
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/sichang824/awesome-shell/internal/exec"
 	"github.com/spf13/cobra"
 )
 
@@ -15,10 +18,28 @@ var rootCmd = &cobra.Command{
 	Long:  "Awesome Shell is a CLI toolkit for database management, devops and daily tasks.",
 }
 
+// exitError makes Execute exit with a specific status instead of 1, for commands used in scripts.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
 // Execute runs the root command.
 func Execute() {
+	enableAudit(dbCmd)
 	if err := rootCmd.Execute(); err != nil {
+		if errors.Is(err, context.Canceled) {
+			fmt.Fprintln(os.Stderr, "Interrupted.")
+			os.Exit(130)
+		}
 		fmt.Fprintln(os.Stderr, err)
+		var ee *exitError
+		if errors.As(err, &ee) {
+			os.Exit(ee.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -27,6 +48,7 @@ func init() {
 	rootCmd.CompletionOptions.DisableDefaultCmd = true
 	rootCmd.Version = version
 	rootCmd.SetVersionTemplate("Awesome Shell version {{.Version}}\n")
+	rootCmd.PersistentFlags().BoolVar(&exec.DryRun, "dry-run", false, "print the SQL statements, Mongo commands and external commands that would change something instead of running them")
 	rootCmd.AddCommand(dbCmd)
 	rootCmd.AddCommand(passwordCmd)
 	rootCmd.AddCommand(dockerCmd)
@@ -4,11 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/sichang824/awesome-shell/internal/exec"
 	"github.com/spf13/cobra"
 )
 
@@ -66,17 +66,11 @@ func runSSHCreateKey(cmd *cobra.Command, args []string) error {
 	filename := filepath.Join(sshDir, "id_rsa_"+time.Now().Format("20060102150405"))
 	fmt.Println("Key path:", filename)
 	// ssh-keygen -t rsa -b 4096 -C email -f filename -N ""
-	c := exec.Command("ssh-keygen", "-t", "rsa", "-b", "4096", "-C", email, "-f", filename, "-N", "")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	if err := c.Run(); err != nil {
+	if err := exec.RunInherit("ssh-keygen", "-t", "rsa", "-b", "4096", "-C", email, "-f", filename, "-N", ""); err != nil {
 		return err
 	}
 	// ssh-add filename
-	add := exec.Command("ssh-add", filename)
-	add.Stdout = os.Stdout
-	add.Stderr = os.Stderr
-	return add.Run()
+	return exec.RunInherit("ssh-add", filename)
 }
 
 func runSSHCheck(cmd *cobra.Command, args []string) error {
@@ -84,11 +78,7 @@ func runSSHCheck(cmd *cobra.Command, args []string) error {
 	if len(args) > 0 {
 		domain = args[0]
 	}
-	c := exec.Command("ssh", "-T", domain)
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	c.Stdin = os.Stdin
-	return c.Run()
+	return exec.RunInheritReadOnly("ssh", "-T", domain)
 }
 
 func runSSHConfig(cmd *cobra.Command, args []string) error {
@@ -105,6 +95,10 @@ func runSSHConfig(cmd *cobra.Command, args []string) error {
 	configFile := filepath.Join(configDir, "git")
 	block := fmt.Sprintf("\nHost %s\n    HostName %s\n    User %s\n    Port 22\n    IdentityFile %s\n",
 		githubDomain, githubDomain, githubUser, filename)
+	if exec.DryRun {
+		fmt.Print("[dry-run] append to ", configFile, ":", block)
+		return nil
+	}
 	f, err := os.OpenFile(configFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
 	if err != nil {
 		return err
@@ -119,8 +113,5 @@ func runSSHConfig(cmd *cobra.Command, args []string) error {
 }
 
 func runSSHListKeys(cmd *cobra.Command, args []string) error {
-	c := exec.Command("ssh-add", "-l")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return c.Run()
+	return exec.RunInheritReadOnly("ssh-add", "-l")
 }
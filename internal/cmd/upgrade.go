@@ -3,9 +3,9 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 
+	"github.com/sichang824/awesome-shell/internal/exec"
 	"github.com/spf13/cobra"
 )
 
@@ -24,20 +24,11 @@ func runUpgrade(cmd *cobra.Command, args []string) error {
 	if _, err := os.Stat(root); err != nil {
 		return fmt.Errorf("directory does not exist: %s", root)
 	}
-	c := exec.Command("git", "-C", root, "fetch", "--all")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	if err := c.Run(); err != nil {
+	if err := exec.RunInherit("git", "-C", root, "fetch", "--all"); err != nil {
 		return err
 	}
-	c = exec.Command("git", "-C", root, "reset", "--hard", "origin/main")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	if err := c.Run(); err != nil {
+	if err := exec.RunInherit("git", "-C", root, "reset", "--hard", "origin/main"); err != nil {
 		return err
 	}
-	c = exec.Command("git", "-C", root, "pull")
-	c.Stdout = os.Stdout
-	c.Stderr = os.Stderr
-	return c.Run()
+	return exec.RunInherit("git", "-C", root, "pull")
 }
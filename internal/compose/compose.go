@@ -0,0 +1,322 @@
+package compose
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are the compose file names looked up in each directory, in Docker Compose's order of preference.
+var FileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// Port is a container port published on the host.
+type Port struct {
+	HostIP    string
+	Published string
+	Target    string
+}
+
+// Service is the part of a compose service needed to reach a database in it.
+type Service struct {
+	Name        string
+	Image       string
+	Ports       []Port
+	Environment map[string]string // environment and env_file entries, interpolated
+}
+
+// File is a parsed compose file.
+type File struct {
+	Path     string
+	Services []Service // sorted by name
+}
+
+// Find returns the nearest compose file in the current directory or up to four parents, or "" if none exists.
+func Find() string {
+	dir, _ := os.Getwd()
+	for i := 0; i < 5; i++ {
+		for _, name := range FileNames {
+			p := filepath.Join(dir, name)
+			if _, err := os.Stat(p); err == nil {
+				return p
+			}
+		}
+		dir = filepath.Dir(dir)
+		if dir == "/" || dir == "." {
+			break
+		}
+	}
+	return ""
+}
+
+// Engine returns the database engine ("mysql", "postgres" or "mongo") an image runs, or "" for other images.
+func Engine(image string) string {
+	name, _, _ := strings.Cut(image, "@")
+	base, _, _ := strings.Cut(path.Base(name), ":")
+	switch {
+	case base == "mysql", base == "mariadb", strings.HasPrefix(base, "percona"), strings.HasPrefix(base, "mysql-server"):
+		return "mysql"
+	case strings.HasPrefix(base, "postgres"), strings.HasPrefix(base, "postgis"), strings.HasPrefix(base, "timescaledb"), base == "pgvector":
+		return "postgres"
+	case base == "mongo", strings.HasPrefix(base, "mongodb"):
+		return "mongo"
+	}
+	return ""
+}
+
+// ByEngine returns the services whose image runs engine.
+func (f *File) ByEngine(engine string) []Service {
+	var out []Service
+	for _, s := range f.Services {
+		if Engine(s.Image) == engine {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// Service returns the service called name.
+func (f *File) Service(name string) (Service, bool) {
+	for _, s := range f.Services {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Service{}, false
+}
+
+// Published returns the host address of container port target, or ok=false when it is not published.
+// Ports bound to all interfaces are reported on 127.0.0.1.
+func (s Service) Published(target string) (host, port string, ok bool) {
+	for _, p := range s.Ports {
+		if p.Target != target || p.Published == "" {
+			continue
+		}
+		host = p.HostIP
+		if host == "" || host == "0.0.0.0" || host == "::" {
+			host = "127.0.0.1"
+		}
+		return host, p.Published, true
+	}
+	return "", "", false
+}
+
+// rawFile mirrors the compose keys Load reads.
+type rawFile struct {
+	Services map[string]struct {
+		Image       string      `yaml:"image"`
+		Ports       []rawPort   `yaml:"ports"`
+		Environment rawEnv      `yaml:"environment"`
+		EnvFile     rawEnvFiles `yaml:"env_file"`
+	} `yaml:"services"`
+}
+
+// rawPort accepts the short ("[ip:]published:target[/proto]") and long port syntax.
+type rawPort Port
+
+func (p *rawPort) UnmarshalYAML(n *yaml.Node) error {
+	if n.Kind == yaml.ScalarNode {
+		spec, _, _ := strings.Cut(n.Value, "/")
+		// An IPv6 host address is written in brackets.
+		if strings.HasPrefix(spec, "[") {
+			if i := strings.Index(spec, "]:"); i >= 0 {
+				p.HostIP, spec = spec[1:i], spec[i+2:]
+			}
+		}
+		parts := strings.Split(spec, ":")
+		switch len(parts) {
+		case 1:
+			p.Target = parts[0]
+		case 2:
+			p.Published, p.Target = parts[0], parts[1]
+		default:
+			p.HostIP, p.Published, p.Target = strings.Join(parts[:len(parts)-2], ":"), parts[len(parts)-2], parts[len(parts)-1]
+		}
+		// A published range maps onto a target range; its first port serves the first target.
+		p.Published, _, _ = strings.Cut(p.Published, "-")
+		p.Target, _, _ = strings.Cut(p.Target, "-")
+		return nil
+	}
+	var long struct {
+		Target    string `yaml:"target"`
+		Published string `yaml:"published"`
+		HostIP    string `yaml:"host_ip"`
+	}
+	if err := n.Decode(&long); err != nil {
+		return err
+	}
+	*p = rawPort{HostIP: long.HostIP, Published: long.Published, Target: long.Target}
+	return nil
+}
+
+// rawEnv accepts environment as a mapping or as a list of KEY=value entries.
+type rawEnv map[string]string
+
+func (e *rawEnv) UnmarshalYAML(n *yaml.Node) error {
+	*e = rawEnv{}
+	if n.Kind == yaml.SequenceNode {
+		var list []string
+		if err := n.Decode(&list); err != nil {
+			return err
+		}
+		for _, kv := range list {
+			k, v, ok := strings.Cut(kv, "=")
+			if !ok {
+				// A bare KEY takes its value from the shell running compose.
+				v = os.Getenv(k)
+			}
+			(*e)[k] = v
+		}
+		return nil
+	}
+	var m map[string]*string
+	if err := n.Decode(&m); err != nil {
+		return err
+	}
+	for k, v := range m {
+		if v == nil {
+			(*e)[k] = os.Getenv(k)
+		} else {
+			(*e)[k] = *v
+		}
+	}
+	return nil
+}
+
+// rawEnvFiles accepts env_file as a path, a list of paths, or a list of {path, required}.
+type rawEnvFiles []struct {
+	Path     string
+	Required bool
+}
+
+func (f *rawEnvFiles) UnmarshalYAML(n *yaml.Node) error {
+	var nodes []*yaml.Node
+	if n.Kind == yaml.SequenceNode {
+		nodes = n.Content
+	} else {
+		nodes = []*yaml.Node{n}
+	}
+	for _, item := range nodes {
+		entry := struct {
+			Path     string
+			Required bool
+		}{Required: true}
+		if item.Kind == yaml.ScalarNode {
+			entry.Path = item.Value
+		} else {
+			var long struct {
+				Path     string `yaml:"path"`
+				Required *bool  `yaml:"required"`
+			}
+			if err := item.Decode(&long); err != nil {
+				return err
+			}
+			entry.Path = long.Path
+			if long.Required != nil {
+				entry.Required = *long.Required
+			}
+		}
+		*f = append(*f, entry)
+	}
+	return nil
+}
+
+// variable matches $$, $NAME, ${NAME} and ${NAME<op>default} with op one of :- - :? ?.
+var variable = regexp.MustCompile(`\$\$|\$([A-Za-z_][A-Za-z0-9_]*)|\$\{([A-Za-z_][A-Za-z0-9_]*)(?:(:?[-?])([^}]*))?\}`)
+
+// interpolate substitutes variables the way compose does, from vars.
+func interpolate(s string, vars map[string]string) string {
+	return variable.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		g := variable.FindStringSubmatch(m)
+		name := g[1] + g[2]
+		v, set := vars[name]
+		switch g[3] {
+		case ":-":
+			if v == "" {
+				return g[4]
+			}
+		case "-":
+			if !set {
+				return g[4]
+			}
+		}
+		return v
+	})
+}
+
+// interpolateNode interpolates every scalar value below n.
+func interpolateNode(n *yaml.Node, vars map[string]string) {
+	if n.Kind == yaml.ScalarNode {
+		n.Value = interpolate(n.Value, vars)
+	}
+	for _, c := range n.Content {
+		interpolateNode(c, vars)
+	}
+}
+
+// Load parses the compose file at p. Values are interpolated from the process environment,
+// then from the .env file next to it, as docker compose does.
+func Load(p string) (*File, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(p)
+	vars, _ := godotenv.Read(filepath.Join(dir, ".env"))
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		vars[k] = v
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	interpolateNode(&doc, vars)
+	var raw rawFile
+	if err := doc.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", p, err)
+	}
+	f := &File{Path: p}
+	for name, s := range raw.Services {
+		env := map[string]string{}
+		for _, ef := range s.EnvFile {
+			ep := ef.Path
+			if !filepath.IsAbs(ep) {
+				ep = filepath.Join(dir, ep)
+			}
+			values, err := godotenv.Read(ep)
+			if err != nil {
+				if ef.Required {
+					return nil, fmt.Errorf("%s: service %s: env_file: %w", p, name, err)
+				}
+				continue
+			}
+			for k, v := range values {
+				env[k] = v
+			}
+		}
+		// environment wins over env_file.
+		for k, v := range s.Environment {
+			env[k] = v
+		}
+		var ports []Port
+		for _, rp := range s.Ports {
+			ports = append(ports, Port(rp))
+		}
+		f.Services = append(f.Services, Service{Name: name, Image: s.Image, Ports: ports, Environment: env})
+	}
+	sort.Slice(f.Services, func(i, j int) bool { return f.Services[i].Name < f.Services[j].Name })
+	return f, nil
+}
@@ -0,0 +1,155 @@
+package composeexec
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sichang824/awesome-shell/internal/exec"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// mongoScript runs the command read from stdin with mongosh and prints its reply as canonical Extended JSON.
+// With cursor set, the documents of the cursor are printed first, one {doc: ...} per line as the batches
+// arrive, so results of any size stream through stdout instead of being gathered into one reply.
+const mongoScript = `
+const out = (doc) => print(EJSON.stringify(doc, {relaxed: false}));
+let res;
+try {
+  const input = EJSON.parse(require('fs').readFileSync(0, 'utf8'), {relaxed: false});
+  if (process.env.AS_MONGO_USER) {
+    db.getSiblingDB('admin').auth(process.env.AS_MONGO_USER, process.env.AS_MONGO_PASSWORD);
+  }
+  const d = db.getSiblingDB(input.db);
+  res = d.runCommand(input.command);
+  if (input.cursor && res.ok) {
+    const coll = res.cursor.ns.substring(res.cursor.ns.indexOf('.') + 1);
+    let batch = res.cursor.firstBatch, id = res.cursor.id;
+    res = {ok: 1};
+    for (;;) {
+      batch.forEach((doc) => out({doc}));
+      if (id.isZero()) break;
+      const more = d.runCommand({getMore: id, collection: coll});
+      if (!more.ok) {
+        res = more;
+        break;
+      }
+      batch = more.cursor.nextBatch;
+      id = more.cursor.id;
+    }
+  }
+} catch (e) {
+  res = {ok: 0, errmsg: String(e.errmsg || e.message), code: e.code || 0, codeName: e.codeName || ''};
+}
+out(res);
+`
+
+// Mongo runs database commands with mongosh inside the service (docker compose exec), one mongosh per command.
+// It covers single commands and cursors; sessions and transactions are not carried from one command to the next.
+type Mongo struct {
+	cfg Config
+}
+
+// NewMongo returns a runner for the MongoDB server of cfg.Service; mongosh authenticates as cfg.User.
+func NewMongo(cfg Config) *Mongo {
+	return &Mongo{cfg: cfg}
+}
+
+// RunCommand runs cmd on database and decodes the reply into result unless it is nil.
+// A reply with ok: 0 is returned as a mongo.CommandError, as the driver does.
+func (m *Mongo) RunCommand(database string, cmd bson.D, result any) error {
+	reply, err := m.run(database, cmd, nil)
+	if err != nil || result == nil {
+		return err
+	}
+	return bson.Unmarshal(reply, result)
+}
+
+// Each runs cmd, which must open a cursor (find, aggregate, listCollections...), and calls fn with every
+// document of it in order.
+func (m *Mongo) Each(database string, cmd bson.D, fn func(bson.Raw) error) error {
+	_, err := m.run(database, cmd, fn)
+	return err
+}
+
+// run runs mongoScript and reads its output line by line: with fn set the cursor documents go to it,
+// and the last line is the reply.
+func (m *Mongo) run(database string, cmd bson.D, fn func(bson.Raw) error) (bson.Raw, error) {
+	input, err := bson.MarshalExtJSON(bson.D{{Key: "db", Value: database}, {Key: "command", Value: cmd}, {Key: "cursor", Value: fn != nil}}, true, false)
+	if err != nil {
+		return nil, err
+	}
+	pr, pw := io.Pipe()
+	var stderr bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		env := map[string]string{"AS_MONGO_USER": m.cfg.User, "AS_MONGO_PASSWORD": m.cfg.Password}
+		err := exec.DockerComposeExecIOReadOnly(m.cfg.Service, env, bytes.NewReader(input), pw, &stderr,
+			"mongosh", "--quiet", "--norc", "--eval", mongoScript)
+		pw.Close()
+		done <- err
+	}()
+
+	var reply bson.Raw
+	var ferr error
+	br := bufio.NewReader(pr)
+	for ferr == nil {
+		line, rerr := br.ReadBytes('\n')
+		// mongosh may print warnings of its own; the output proper is one document per line.
+		if line = bytes.TrimSpace(line); len(line) > 0 && line[0] == '{' {
+			var doc bson.D
+			if err := bson.UnmarshalExtJSON(line, true, &doc); err != nil {
+				ferr = fmt.Errorf("reading mongosh output: %w", err)
+				break
+			}
+			if fn != nil && len(doc) == 1 && doc[0].Key == "doc" {
+				var raw bson.Raw
+				if raw, ferr = bson.Marshal(doc[0].Value); ferr == nil {
+					ferr = fn(raw)
+				}
+			} else {
+				reply, ferr = bson.Marshal(doc)
+			}
+		}
+		if rerr != nil {
+			break
+		}
+	}
+	// Stops mongosh when fn gave up early; the rest of its output is not read.
+	pr.Close()
+	if err := <-done; err != nil && ferr == nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, errors.New("docker compose exec " + m.cfg.Service + ": " + msg)
+	}
+	if ferr != nil {
+		return nil, ferr
+	}
+	if reply == nil {
+		return nil, errors.New("mongosh printed no reply")
+	}
+	return reply, commandError(reply)
+}
+
+// commandError returns the error of a reply with ok: 0, nil otherwise.
+func commandError(reply bson.Raw) error {
+	var r struct {
+		OK       float64 `bson:"ok"`
+		ErrMsg   string  `bson:"errmsg"`
+		Code     int32   `bson:"code"`
+		CodeName string  `bson:"codeName"`
+	}
+	if err := bson.Unmarshal(reply, &r); err != nil {
+		return err
+	}
+	if r.OK == 1 {
+		return nil
+	}
+	return mongo.CommandError{Code: r.Code, Message: r.ErrMsg, Name: r.CodeName, Raw: reply}
+}
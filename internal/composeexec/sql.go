@@ -0,0 +1,429 @@
+package composeexec
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sichang824/awesome-shell/internal/exec"
+)
+
+// Engines reachable through Connector.
+const (
+	MySQL    = "mysql"
+	Postgres = "postgres"
+)
+
+// pgNull is what psql prints for NULL; a text value equal to it reads back as NULL too.
+const pgNull = `\N`
+
+// Config says how to reach the database server of a compose service with its own command-line client.
+type Config struct {
+	Service  string
+	Engine   string // MySQL or Postgres
+	User     string
+	Password string
+	Database string
+}
+
+// Connector is a database/sql connector that runs every statement with the mysql or psql client
+// inside the service (docker compose exec) and parses its output back into rows.
+// Each statement runs in a new client session, so session state such as USE, SET or a transaction does not carry over.
+type Connector struct {
+	cfg Config
+}
+
+// NewConnector returns a connector for cfg; use it with sql.OpenDB.
+func NewConnector(cfg Config) *Connector {
+	return &Connector{cfg: cfg}
+}
+
+// Connect implements driver.Connector.
+func (c *Connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{cfg: c.cfg}, nil
+}
+
+// Driver implements driver.Connector.
+func (c *Connector) Driver() driver.Driver {
+	return sqlDriver{}
+}
+
+type sqlDriver struct{}
+
+func (sqlDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("composeexec: open connections with sql.OpenDB(composeexec.NewConnector(cfg))")
+}
+
+type conn struct {
+	cfg Config
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return &stmt{conn: c, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported through docker compose exec, where every statement runs in a new session")
+}
+
+func (c *conn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	q, err := c.interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.Engine == MySQL {
+		sets, err := c.runMySQL(q + ";\nSELECT ROW_COUNT(), LAST_INSERT_ID();\n")
+		if err != nil {
+			return nil, err
+		}
+		if len(sets) == 0 || len(sets[len(sets)-1].rows) == 0 {
+			return nil, errors.New("mysql printed no result for ROW_COUNT()")
+		}
+		last := sets[len(sets)-1]
+		affected, _ := strconv.ParseInt(last.rows[0][0].(string), 10, 64)
+		id, _ := strconv.ParseInt(last.rows[0][1].(string), 10, 64)
+		return result{affected: affected, lastID: id}, nil
+	}
+	out, err := c.runPsql(q+";\n", false)
+	if err != nil {
+		return nil, err
+	}
+	return result{affected: pgAffected(out), lastID: -1}, nil
+}
+
+func (c *conn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, err := c.interpolate(query, args)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.Engine == MySQL {
+		sets, err := c.runMySQL(q + ";\n")
+		if err != nil {
+			return nil, err
+		}
+		if len(sets) == 0 {
+			return &rows{}, nil
+		}
+		return &sets[0], nil
+	}
+	out, err := c.runPsql(q+";\n", true)
+	if err != nil {
+		return nil, err
+	}
+	return parsePgCSV(out)
+}
+
+type stmt struct {
+	conn  *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.conn.ExecContext(context.Background(), s.query, named(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.conn.QueryContext(context.Background(), s.query, named(args))
+}
+
+func named(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+type result struct {
+	affected, lastID int64
+}
+
+func (r result) LastInsertId() (int64, error) {
+	if r.lastID < 0 {
+		return 0, errors.New("LastInsertId is not supported by PostgreSQL")
+	}
+	return r.lastID, nil
+}
+
+func (r result) RowsAffected() (int64, error) { return r.affected, nil }
+
+// rows is a fully read result set; values are strings or nil.
+type rows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *rows) Columns() []string { return r.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
+
+// run runs the engine's client in the service with script on stdin and returns its stdout.
+func (c *conn) run(script string, env map[string]string, args ...string) (string, error) {
+	var out, stderr bytes.Buffer
+	if err := exec.DockerComposeExecIOReadOnly(c.cfg.Service, env, strings.NewReader(script), &out, &stderr, args...); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", clientError(c.cfg.Engine, msg)
+		}
+		return "", fmt.Errorf("docker compose exec %s: %w", c.cfg.Service, err)
+	}
+	return out.String(), nil
+}
+
+// mysqlError matches the error line of the mysql client.
+var mysqlError = regexp.MustCompile(`(?m)^ERROR (\d+) \(([0-9A-Z]{5})\)(?: at line \d+)?: (.*)$`)
+
+// pgError matches the error line of psql with VERBOSITY=verbose.
+var pgError = regexp.MustCompile(`(?m)^(?:psql:[^\n]*?: )?(ERROR|FATAL|PANIC):  ([0-9A-Z]{5}): (.*)$`)
+
+// clientError turns the error output of the client into the error type of the Go driver, so callers
+// can match codes the same way; other output is returned as it is.
+func clientError(engine, msg string) error {
+	if engine == MySQL {
+		if m := mysqlError.FindStringSubmatch(msg); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			e := &mysql.MySQLError{Number: uint16(n), Message: m[3]}
+			copy(e.SQLState[:], m[2])
+			return e
+		}
+		return errors.New(msg)
+	}
+	if m := pgError.FindStringSubmatch(msg); m != nil {
+		return &pq.Error{Severity: m[1], Code: pq.ErrorCode(m[2]), Message: m[3]}
+	}
+	return errors.New(msg)
+}
+
+func (c *conn) runMySQL(script string) ([]rows, error) {
+	args := []string{"mysql", "--batch", "--xml", "--default-character-set=utf8mb4", "-u", c.cfg.User}
+	if c.cfg.Database != "" {
+		args = append(args, "-D", c.cfg.Database)
+	}
+	// time.Time arguments are written in UTC, so the session reads them in UTC whatever the server's time_zone.
+	out, err := c.run("SET time_zone = '+00:00';\n"+script, map[string]string{"MYSQL_PWD": c.cfg.Password}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseMySQLXML(out)
+}
+
+// parseMySQLXML reads the result sets printed by mysql --xml; NULL fields carry xsi:nil="true".
+func parseMySQLXML(out string) ([]rows, error) {
+	var sets []rows
+	d := xml.NewDecoder(strings.NewReader(out))
+	var row []driver.Value
+	var field *strings.Builder
+	var null bool
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return sets, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading mysql output: %w", err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "resultset":
+				sets = append(sets, rows{})
+			case "row":
+				row = nil
+			case "field":
+				field, null = &strings.Builder{}, false
+				set := &sets[len(sets)-1]
+				for _, a := range t.Attr {
+					switch a.Name.Local {
+					case "name":
+						if len(set.rows) == 0 {
+							set.columns = append(set.columns, a.Value)
+						}
+					case "nil":
+						null = a.Value == "true"
+					}
+				}
+			}
+		case xml.CharData:
+			if field != nil {
+				field.Write(t)
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "field":
+				if null {
+					row = append(row, nil)
+				} else {
+					row = append(row, field.String())
+				}
+				field = nil
+			case "row":
+				set := &sets[len(sets)-1]
+				set.rows = append(set.rows, row)
+			}
+		}
+	}
+}
+
+func (c *conn) runPsql(script string, quiet bool) (string, error) {
+	args := []string{"psql", "-X", "--csv", "-v", "ON_ERROR_STOP=1", "-v", "VERBOSITY=verbose", "-P", "null=" + pgNull, "-U", c.cfg.User}
+	if quiet {
+		// Quiet leaves out the command tags, so only the result set is printed.
+		args = append(args, "-q")
+	}
+	if c.cfg.Database != "" {
+		args = append(args, "-d", c.cfg.Database)
+	}
+	return c.run(script, map[string]string{"PGPASSWORD": c.cfg.Password}, args...)
+}
+
+// parsePgCSV reads the result set printed by psql --csv: a header line, then one record per row.
+func parsePgCSV(out string) (*rows, error) {
+	r := csv.NewReader(strings.NewReader(out))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("reading psql output: %w", err)
+	}
+	if len(records) == 0 {
+		return &rows{}, nil
+	}
+	set := &rows{columns: records[0]}
+	for _, rec := range records[1:] {
+		row := make([]driver.Value, len(rec))
+		for i, v := range rec {
+			if v != pgNull {
+				row[i] = v
+			}
+		}
+		set.rows = append(set.rows, row)
+	}
+	return set, nil
+}
+
+// pgTag matches a command tag that ends in a row count, e.g. "INSERT 0 3" or "UPDATE 2".
+var pgTag = regexp.MustCompile(`(?m)^[A-Z][A-Z ]*(?: \d+)? (\d+)$`)
+
+// pgAffected returns the row count of the last command tag in psql output, 0 when there is none.
+func pgAffected(out string) int64 {
+	m := pgTag.FindAllStringSubmatch(out, -1)
+	if len(m) == 0 {
+		return 0
+	}
+	n, _ := strconv.ParseInt(m[len(m)-1][1], 10, 64)
+	return n
+}
+
+// interpolate replaces the placeholders of query (? for MySQL, $n for PostgreSQL) outside quotes
+// with the literal values of args, since the clients cannot bind parameters.
+func (c *conn) interpolate(query string, args []driver.NamedValue) (string, error) {
+	if len(args) == 0 {
+		return query, nil
+	}
+	var b strings.Builder
+	next := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		ch := query[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && c.cfg.Engine == MySQL && i+1 < len(query) {
+				b.WriteByte(ch)
+				i++
+				ch = query[i]
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '\'' || ch == '"' || ch == '`':
+			quote = ch
+		case ch == '?' && c.cfg.Engine == MySQL:
+			if next >= len(args) {
+				return "", fmt.Errorf("query has more placeholders than the %d arguments", len(args))
+			}
+			b.WriteString(literal(c.cfg.Engine, args[next].Value))
+			next++
+			continue
+		case ch == '$' && c.cfg.Engine == Postgres && i+1 < len(query) && query[i+1] >= '0' && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			if n < 1 || n > len(args) {
+				return "", fmt.Errorf("placeholder $%d has no argument", n)
+			}
+			b.WriteString(literal(c.cfg.Engine, args[n-1].Value))
+			i = j - 1
+			continue
+		}
+		b.WriteByte(ch)
+	}
+	return b.String(), nil
+}
+
+// literal renders v as an SQL literal of engine.
+func literal(engine string, v driver.Value) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		if engine == MySQL {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		return strings.ToUpper(strconv.FormatBool(v))
+	case time.Time:
+		if engine == MySQL {
+			// runMySQL sets the session time zone to UTC.
+			return quote(engine, v.UTC().Format("2006-01-02 15:04:05.999999"))
+		}
+		return quote(engine, v.Format("2006-01-02 15:04:05.999999Z07:00"))
+	case []byte:
+		if engine == MySQL {
+			return "X'" + hex.EncodeToString(v) + "'"
+		}
+		return `'\x` + hex.EncodeToString(v) + `'::bytea`
+	case string:
+		return quote(engine, v)
+	}
+	return quote(engine, fmt.Sprint(v))
+}
+
+func quote(engine, s string) string {
+	if engine == Postgres {
+		return pq.QuoteLiteral(s)
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\n", `\n`, "\r", `\r`, "\x1a", `\Z`).Replace(s) + "'"
+}
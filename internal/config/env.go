@@ -3,6 +3,8 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -12,18 +14,25 @@ func LoadEnv() {
 	// Try current dir first
 	_ = godotenv.Load(".env")
 	// Try workspace root (where docker-compose usually is)
+	if p := FindEnvFile(); p != "" {
+		_ = godotenv.Load(p)
+	}
+}
+
+// FindEnvFile returns the nearest .env in the current directory or up to four parents, or "" if none exists.
+func FindEnvFile() string {
 	cwd, _ := os.Getwd()
 	for i := 0; i < 5; i++ {
 		p := filepath.Join(cwd, ".env")
 		if _, err := os.Stat(p); err == nil {
-			_ = godotenv.Load(p)
-			return
+			return p
 		}
 		cwd = filepath.Dir(cwd)
 		if cwd == "/" || cwd == "." {
 			break
 		}
 	}
+	return ""
 }
 
 // GetEnv returns env var or default.
@@ -33,3 +42,56 @@ func GetEnv(key, def string) string {
 	}
 	return def
 }
+
+// plainEnvValue matches values that need no quoting in a .env file.
+var plainEnvValue = regexp.MustCompile(`^[A-Za-z0-9_./:@+=,-]*$`)
+
+// SetEnvValue sets key=value in the .env file at path, replacing the first existing assignment
+// (keeping an "export " prefix) or appending one. Comments, blank lines and ordering are preserved.
+func SetEnvValue(path, key, value string) error {
+	if !plainEnvValue.MatchString(value) {
+		value = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`).Replace(value) + `"`
+	}
+	mode := os.FileMode(0600)
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		mode = info.Mode().Perm()
+	}
+	assign := regexp.MustCompile(`^(\s*(?:export\s+)?)` + regexp.QuoteMeta(key) + `\s*=`)
+	text := string(content)
+	lines := strings.Split(text, "\n")
+	found := false
+	for i, l := range lines {
+		if m := assign.FindStringSubmatch(l); m != nil {
+			// Keep an inline comment after an unquoted value.
+			comment := ""
+			rest := strings.TrimSpace(l[len(m[0]):])
+			if !strings.HasPrefix(rest, `"`) && !strings.HasPrefix(rest, "'") {
+				if idx := strings.Index(rest, " #"); idx >= 0 {
+					comment = rest[idx:]
+				}
+			}
+			lines[i] = m[1] + key + "=" + value + comment
+			found = true
+			break
+		}
+	}
+	if !found {
+		if text == "" {
+			lines = []string{key + "=" + value, ""}
+		} else {
+			if lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+			lines = append(lines, key+"="+value, "")
+		}
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
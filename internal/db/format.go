@@ -0,0 +1,153 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Binary display modes for ValueFormatter.
+const (
+	BinaryHex      = "hex"
+	BinaryTruncate = "truncate"
+)
+
+// ValueFormatter renders values scanned from database/sql rows as display text,
+// using the column's database type (rows.ColumnTypes) to pick the representation.
+type ValueFormatter struct {
+	Engine      string         // "mysql" or "postgres"; decides which time types are zone-aware
+	Null        string         // text shown for NULL
+	Location    *time.Location // zone for zone-aware time columns; nil keeps the driver's zone
+	SessionZone *time.Location // MySQL session zone that TIMESTAMP text is returned in; nil shows the text as is
+	Binary      string         // BinaryHex or BinaryTruncate
+	MaxBinary   int            // bytes shown in BinaryTruncate mode
+}
+
+// zonedTypes lists column types whose values are instants and get converted to Location.
+// MySQL TIMESTAMP is stored as UTC; DATETIME and PostgreSQL TIMESTAMP are wall-clock values.
+var zonedTypes = map[string]map[string]bool{
+	"mysql":    {"TIMESTAMP": true},
+	"postgres": {"TIMESTAMPTZ": true, "TIMETZ": true},
+}
+
+var binaryTypes = map[string]bool{
+	"BLOB": true, "TINYBLOB": true, "MEDIUMBLOB": true, "LONGBLOB": true,
+	"BINARY": true, "VARBINARY": true, "BIT": true, "GEOMETRY": true,
+	"BYTEA": true,
+}
+
+// Format returns the display text for v, a value scanned into interface{} from a column of type ct.
+func (f *ValueFormatter) Format(ct *sql.ColumnType, v interface{}) string {
+	if v == nil {
+		return f.Null
+	}
+	typ := ""
+	if ct != nil {
+		typ = strings.ToUpper(ct.DatabaseTypeName())
+	}
+	switch x := v.(type) {
+	case []byte:
+		return f.formatBytes(typ, x)
+	case string:
+		return f.formatBytes(typ, []byte(x))
+	case time.Time:
+		return f.formatTime(typ, x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case uint64:
+		return strconv.FormatUint(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(x), 'g', -1, 32)
+	case bool:
+		return strconv.FormatBool(x)
+	default:
+		return sanitize(fmt.Sprint(x))
+	}
+}
+
+func (f *ValueFormatter) formatBytes(typ string, b []byte) string {
+	switch {
+	case f.Engine == "mysql" && typ == "TIMESTAMP" && f.SessionZone != nil:
+		if t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", string(b), f.SessionZone); err == nil {
+			return f.formatTime(typ, t)
+		}
+	case binaryTypes[typ]:
+		return f.formatBinary(b)
+	case typ == "JSON" || typ == "JSONB":
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, b); err == nil {
+			return sanitize(buf.String())
+		}
+	}
+	// Text, DECIMAL/NUMERIC, UUID, arrays ({1,2}), TIME and other types the driver
+	// leaves as text are shown verbatim; invalid UTF-8 is treated as binary.
+	if !utf8.Valid(b) {
+		return f.formatBinary(b)
+	}
+	return sanitize(string(b))
+}
+
+func (f *ValueFormatter) formatBinary(b []byte) string {
+	if f.Binary == BinaryTruncate && f.MaxBinary > 0 && len(b) > f.MaxBinary {
+		return fmt.Sprintf("0x%s... (%d bytes)", hex.EncodeToString(b[:f.MaxBinary]), len(b))
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+func (f *ValueFormatter) formatTime(typ string, t time.Time) string {
+	zoned := zonedTypes[f.Engine][typ]
+	if zoned && f.Location != nil {
+		t = t.In(f.Location)
+	}
+	switch typ {
+	case "DATE":
+		if t.IsZero() && f.Engine == "mysql" {
+			return "0000-00-00"
+		}
+		return t.Format("2006-01-02")
+	case "TIME":
+		return t.Format("15:04:05.999999")
+	case "TIMETZ":
+		return t.Format("15:04:05.999999-07:00")
+	}
+	if t.IsZero() && f.Engine == "mysql" {
+		return "0000-00-00 00:00:00"
+	}
+	if zoned {
+		return t.Format("2006-01-02 15:04:05.999999 -07:00")
+	}
+	return t.Format("2006-01-02 15:04:05.999999")
+}
+
+// sanitize escapes control characters so cell values cannot break the
+// tab-separated layout or send escape sequences to the terminal.
+func sanitize(s string) string {
+	if strings.IndexFunc(s, unicode.IsControl) < 0 {
+		return s
+	}
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case unicode.IsControl(r):
+			fmt.Fprintf(&b, `\x%02x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
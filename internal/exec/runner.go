@@ -3,12 +3,62 @@ package exec
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	osexec "os/exec"
+	"sort"
+	"strings"
 )
 
+// DryRun makes the runners print the command line instead of spawning it (set by --dry-run).
+// RunReadOnly is exempt so commands can still inspect state.
+var DryRun bool
+
+// skip prints the command line and reports true when DryRun is set.
+func skip(name string, args []string) bool {
+	if !DryRun {
+		return false
+	}
+	fmt.Println("[dry-run]", CommandLine(name, args...))
+	return true
+}
+
+// CommandLine renders argv as a shell-quoted command line.
+func CommandLine(name string, args ...string) string {
+	parts := []string{name}
+	for _, a := range args {
+		if a == "" || strings.ContainsAny(a, " \t\n'\"\\$`|&;<>()*?[]{}~#!") {
+			a = "'" + strings.ReplaceAll(a, "'", `'\''`) + "'"
+		}
+		parts = append(parts, a)
+	}
+	return strings.Join(parts, " ")
+}
+
+// RunReadOnly runs a command that only inspects state, even under DryRun, and returns its output.
+func RunReadOnly(name string, args ...string) (stdout, stderr string, err error) {
+	cmd := osexec.Command(name, args...)
+	var outBuf, errBuf bytes.Buffer
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+	err = cmd.Run()
+	return outBuf.String(), errBuf.String(), err
+}
+
+// RunInheritReadOnly is RunInherit for commands that only inspect state; it runs even under DryRun.
+func RunInheritReadOnly(name string, args ...string) error {
+	cmd := osexec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
 // Run runs command and returns combined output and error.
 func Run(name string, args ...string) (stdout, stderr string, err error) {
+	if skip(name, args) {
+		return "", "", nil
+	}
 	cmd := osexec.Command(name, args...)
 	var outBuf, errBuf bytes.Buffer
 	cmd.Stdout = &outBuf
@@ -19,6 +69,9 @@ func Run(name string, args ...string) (stdout, stderr string, err error) {
 
 // RunInherit runs command with stdin/stdout/stderr connected to current process.
 func RunInherit(name string, args ...string) error {
+	if skip(name, args) {
+		return nil
+	}
 	cmd := osexec.Command(name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -28,6 +81,9 @@ func RunInherit(name string, args ...string) error {
 
 // RunInheritWithEnv runs command with extra env vars and inherited stdin/stdout/stderr.
 func RunInheritWithEnv(env map[string]string, name string, args ...string) error {
+	if skip(name, args) {
+		return nil
+	}
 	cmd := osexec.Command(name, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
@@ -41,6 +97,10 @@ func RunInheritWithEnv(env map[string]string, name string, args ...string) error
 
 // RunDir runs command in the given directory.
 func RunDir(dir, name string, args ...string) (stdout, stderr string, err error) {
+	if DryRun {
+		fmt.Println("[dry-run] cd", CommandLine(dir), "&&", CommandLine(name, args...))
+		return "", "", nil
+	}
 	cmd := osexec.Command(name, args...)
 	cmd.Dir = dir
 	var outBuf, errBuf bytes.Buffer
@@ -64,21 +124,70 @@ func DockerComposeExecTTY(service string, args ...string) error {
 	return RunInherit("docker", a...)
 }
 
-// DockerComposeExecTTYWithEnv runs: docker compose exec -e KEY=val <service> <args>
+// DockerComposeExecTTYWithEnv runs: docker compose exec -e KEY <service> <args>
+// The values reach the container through the environment of docker, so they stay off its command line.
 func DockerComposeExecTTYWithEnv(service string, env map[string]string, args ...string) error {
-	a := []string{"compose", "exec"}
-	for k, v := range env {
-		a = append(a, "-e", k+"="+v)
+	a := composeExecArgs(false, service, env, args)
+	if skip("docker", a) {
+		return nil
 	}
-	a = append(a, service)
-	a = append(a, args...)
 	cmd := osexec.Command("docker", a...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	cmd.Env = withEnv(env)
+	return cmd.Run()
+}
+
+// DockerComposeExecIO runs docker compose exec -T -e KEY <service> <args> with the given stdin, stdout and stderr.
+func DockerComposeExecIO(service string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	a := composeExecArgs(true, service, env, args)
+	if skip("docker", a) {
+		return nil
+	}
+	return dockerComposeExecIO(a, env, stdin, stdout, stderr)
+}
+
+// DockerComposeExecIOReadOnly is DockerComposeExecIO for commands that only inspect state; it runs even under DryRun.
+func DockerComposeExecIOReadOnly(service string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+	return dockerComposeExecIO(composeExecArgs(true, service, env, args), env, stdin, stdout, stderr)
+}
+
+func dockerComposeExecIO(args []string, env map[string]string, stdin io.Reader, stdout, stderr io.Writer) error {
+	cmd := osexec.Command("docker", args...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = withEnv(env)
 	return cmd.Run()
 }
 
+// composeExecArgs builds the docker arguments of compose exec; env keys are passed by name only.
+func composeExecArgs(noTTY bool, service string, env map[string]string, args []string) []string {
+	a := []string{"compose", "exec"}
+	if noTTY {
+		a = append(a, "-T")
+	}
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		a = append(a, "-e", k)
+	}
+	a = append(a, service)
+	return append(a, args...)
+}
+
+func withEnv(env map[string]string) []string {
+	e := os.Environ()
+	for k, v := range env {
+		e = append(e, k+"="+v)
+	}
+	return e
+}
+
 // MustDockerOut runs Docker compose exec and returns stdout; exits on error.
 func MustDockerOut(service string, args ...string) string {
 	out, stderr, err := DockerComposeExec(service, args...)
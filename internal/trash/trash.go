@@ -0,0 +1,145 @@
+package trash
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sichang824/awesome-shell/internal/audit"
+)
+
+// metaFile holds the Entry of a backup directory; directories without it are unfinished dumps.
+const metaFile = "meta.json"
+
+// Entry describes one backup taken before a database was dropped.
+type Entry struct {
+	ID       string            `json:"id"`
+	Engine   string            `json:"engine"`
+	Server   string            `json:"server"`
+	Database string            `json:"database"`
+	Time     time.Time         `json:"time"`
+	File     string            `json:"file"`
+	Size     int64             `json:"size"`
+	Options  map[string]string `json:"options,omitempty"`
+}
+
+// Dir returns the trash directory under the audit state directory.
+func Dir() string {
+	return filepath.Join(audit.Dir(), "trash")
+}
+
+// Path returns the dump file of e.
+func (e Entry) Path() string {
+	return filepath.Join(Dir(), e.ID, e.File)
+}
+
+// New creates the directory for a backup of database whose dump is written to file inside it.
+func New(engine, server, database, file string) (Entry, error) {
+	now := time.Now().UTC()
+	e := Entry{
+		ID:       now.Format("20060102-150405") + "-" + engine + "-" + database,
+		Engine:   engine,
+		Server:   server,
+		Database: database,
+		Time:     now,
+		File:     file,
+		Options:  map[string]string{},
+	}
+	if err := os.MkdirAll(Dir(), 0o700); err != nil {
+		return e, err
+	}
+	return e, os.Mkdir(filepath.Join(Dir(), e.ID), 0o700)
+}
+
+// Save records the size of the finished dump and writes the metadata, making e visible to List.
+func Save(e *Entry) error {
+	fi, err := os.Stat(e.Path())
+	if err != nil {
+		return err
+	}
+	e.Size = fi.Size()
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(Dir(), e.ID, metaFile), append(b, '\n'), 0o600)
+}
+
+// Remove deletes the backup directory of e.
+func Remove(e Entry) error {
+	return os.RemoveAll(filepath.Join(Dir(), e.ID))
+}
+
+// List returns the finished backups, oldest first.
+func List() ([]Entry, error) {
+	dirs, err := os.ReadDir(Dir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		b, err := os.ReadFile(filepath.Join(Dir(), d.Name(), metaFile))
+		if err != nil {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(b, &e); err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name(), err)
+		}
+		e.ID = d.Name()
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// Find returns the backup whose ID equals or uniquely starts with id.
+func Find(id string) (Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return Entry{}, err
+	}
+	var found []Entry
+	for _, e := range entries {
+		if e.ID == id {
+			return e, nil
+		}
+		if strings.HasPrefix(e.ID, id) {
+			found = append(found, e)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Entry{}, fmt.Errorf("no trash entry %q (see as db trash list)", id)
+	case 1:
+		return found[0], nil
+	}
+	return Entry{}, fmt.Errorf("trash entry %q is ambiguous (%d matches)", id, len(found))
+}
+
+// Expired returns the backups to remove so none is older than maxAge and together they take at most maxSize bytes.
+// Zero disables either limit; the oldest backups go first.
+func Expired(entries []Entry, maxAge time.Duration, maxSize int64) []Entry {
+	var expired []Entry
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	for _, e := range entries {
+		if (maxAge > 0 && time.Since(e.Time) > maxAge) || (maxSize > 0 && total > maxSize) {
+			expired = append(expired, e)
+			total -= e.Size
+		}
+	}
+	return expired
+}
@@ -0,0 +1,252 @@
+package tunnel
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Options describe the bastion host database connections are dialed through.
+type Options struct {
+	Target     string        // user@host[:port]; the user defaults to the OS user and the port to 22
+	KeyFile    string        // private key; without one, ssh-agent and the default ~/.ssh/id_* keys are tried
+	KnownHosts string        // default ~/.ssh/known_hosts
+	Timeout    time.Duration // for connecting to the bastion; default 15s
+}
+
+// Tunnel is an SSH connection to a bastion; its Dial methods open TCP connections from the bastion's side.
+type Tunnel struct {
+	client *ssh.Client
+}
+
+// ParseTarget splits user@host[:port] into the user and a host:port address.
+func ParseTarget(target string) (string, string, error) {
+	name, host, ok := strings.Cut(target, "@")
+	if !ok {
+		host, name = target, ""
+	}
+	if name == "" {
+		u, err := user.Current()
+		if err != nil {
+			return "", "", fmt.Errorf("ssh target %q: no user given and %w", target, err)
+		}
+		name = u.Username
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid ssh target %q (use user@host[:port])", target)
+	}
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), "22")
+	}
+	return name, host, nil
+}
+
+func sshDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh")
+}
+
+// authMethods returns the key file if given, otherwise the ssh-agent keys followed by the default key files.
+func authMethods(keyFile string) ([]ssh.AuthMethod, error) {
+	if keyFile != "" {
+		signer, err := readKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, nil
+	}
+	var methods []ssh.AuthMethod
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	var signers []ssh.Signer
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		// Encrypted default keys are skipped; they are expected to be in the agent.
+		if signer, err := readKey(filepath.Join(sshDir(), name)); err == nil {
+			signers = append(signers, signer)
+		}
+	}
+	if len(signers) > 0 {
+		methods = append(methods, ssh.PublicKeys(signers...))
+	}
+	if len(methods) == 0 {
+		return nil, errors.New("no ssh credentials: pass --ssh-key, start ssh-agent or create ~/.ssh/id_ed25519")
+	}
+	return methods, nil
+}
+
+func readKey(path string) (ssh.Signer, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(b)
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) {
+		return nil, fmt.Errorf("%s is protected by a passphrase; add it to ssh-agent (ssh-add %s) instead", path, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// hostKeyAlgorithms lists the negotiable algorithms for the key types already in known_hosts.
+func hostKeyAlgorithms(keys []knownhosts.KnownKey) []string {
+	var algos []string
+	for _, k := range keys {
+		if t := k.Key.Type(); t == ssh.KeyAlgoRSA {
+			algos = append(algos, ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA)
+		} else {
+			algos = append(algos, t)
+		}
+	}
+	return algos
+}
+
+// Open connects and authenticates to the bastion, verifying its host key against known_hosts.
+func Open(o Options) (*Tunnel, error) {
+	name, addr, err := ParseTarget(o.Target)
+	if err != nil {
+		return nil, err
+	}
+	knownHostsFile := o.KnownHosts
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(sshDir(), "known_hosts")
+	}
+	hostKeys, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("known_hosts: %w", err)
+	}
+	auth, err := authMethods(o.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	timeout := o.Timeout
+	if timeout <= 0 {
+		timeout = 15 * time.Second
+	}
+	cfg := &ssh.ClientConfig{User: name, Auth: auth, HostKeyCallback: hostKeys, Timeout: timeout}
+	client, err := ssh.Dial("tcp", addr, cfg)
+	var keyErr *knownhosts.KeyError
+	if errors.As(err, &keyErr) && len(keyErr.Want) > 0 && cfg.HostKeyAlgorithms == nil {
+		// known_hosts may hold a different key type than the one the server offered first; ask for those.
+		cfg.HostKeyAlgorithms = hostKeyAlgorithms(keyErr.Want)
+		client, err = ssh.Dial("tcp", addr, cfg)
+	}
+	if errors.As(err, &keyErr) {
+		if len(keyErr.Want) == 0 {
+			return nil, fmt.Errorf("ssh %s: host key is not in %s; connect once with ssh to verify and record it", addr, knownHostsFile)
+		}
+		return nil, fmt.Errorf("ssh %s: HOST KEY MISMATCH with %s:%d; the bastion may be impersonated", addr, keyErr.Want[0].Filename, keyErr.Want[0].Line)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ssh %s: %w", addr, err)
+	}
+	return &Tunnel{client: client}, nil
+}
+
+// DialContext opens a connection to address as seen from the bastion.
+func (t *Tunnel) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return t.client.DialContext(ctx, network, address)
+}
+
+// Dial opens a connection to address as seen from the bastion.
+func (t *Tunnel) Dial(network, address string) (net.Conn, error) {
+	return t.client.Dial(network, address)
+}
+
+// DialTimeout is Dial bounded by timeout.
+func (t *Tunnel) DialTimeout(network, address string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return t.client.DialContext(ctx, network, address)
+}
+
+// Forward listens on a free local port and relays a single connection to remote through the bastion,
+// for an external tool that cannot use the Dial methods. It returns the local host:port and a closer
+// that stops the listener and the relayed connection once the tool has exited.
+func (t *Tunnel) Forward(remote string) (string, io.Closer, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	f := &forward{listener: l}
+	go f.serve(t.client, remote)
+	return l.Addr().String(), f, nil
+}
+
+// forward relays the first connection accepted on listener; nothing else may connect to the port.
+type forward struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    []net.Conn
+	closed   bool
+}
+
+func (f *forward) serve(client *ssh.Client, remote string) {
+	local, err := f.listener.Accept()
+	f.listener.Close()
+	if err != nil {
+		return
+	}
+	conn, err := client.Dial("tcp", remote)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ssh forward:", err)
+		local.Close()
+		return
+	}
+	if !f.track(local, conn) {
+		return
+	}
+	go func() {
+		io.Copy(conn, local)
+		conn.Close()
+	}()
+	io.Copy(local, conn)
+	local.Close()
+}
+
+// track records the relayed connections, or closes them when the forward was already closed.
+func (f *forward) track(conns ...net.Conn) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		for _, c := range conns {
+			c.Close()
+		}
+		return false
+	}
+	f.conns = append(f.conns, conns...)
+	return true
+}
+
+// Close stops the listener and closes the relayed connection.
+func (f *forward) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	for _, c := range f.conns {
+		c.Close()
+	}
+	return f.listener.Close()
+}
+
+// Close closes the SSH connection and every connection dialed through it.
+func (t *Tunnel) Close() error {
+	return t.client.Close()
+}
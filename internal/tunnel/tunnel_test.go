@@ -0,0 +1,387 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// server is an in-process SSH server that accepts one client key and serves direct-tcpip channels.
+type server struct {
+	addr     string
+	hostKeys []ssh.Signer
+}
+
+func newSigner(t *testing.T, rsaKey bool) (ssh.Signer, any) {
+	t.Helper()
+	var key any
+	if rsaKey {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = k
+	} else {
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key = k
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, key
+}
+
+// startServer listens on a free port with the given host keys and accepts clients authenticating with client.
+func startServer(t *testing.T, client ssh.PublicKey, hostKeys ...ssh.Signer) *server {
+	t.Helper()
+	cfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(client.Marshal()) {
+				return nil, io.EOF
+			}
+			return nil, nil
+		},
+	}
+	for _, k := range hostKeys {
+		cfg.AddHostKey(k)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(c, cfg)
+		}
+	}()
+	return &server{addr: l.Addr().String(), hostKeys: hostKeys}
+}
+
+func serveConn(c net.Conn, cfg *ssh.ServerConfig) {
+	defer c.Close()
+	_, chans, reqs, err := ssh.NewServerConn(c, cfg)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "direct-tcpip" {
+			nc.Reject(ssh.UnknownChannelType, "unsupported")
+			continue
+		}
+		// The payload starts with the target host (length-prefixed) followed by the port.
+		data := nc.ExtraData()
+		n := binary.BigEndian.Uint32(data)
+		host := string(data[4 : 4+n])
+		port := binary.BigEndian.Uint32(data[4+n:])
+		target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.FormatUint(uint64(port), 10)))
+		if err != nil {
+			nc.Reject(ssh.ConnectionFailed, err.Error())
+			continue
+		}
+		ch, creqs, err := nc.Accept()
+		if err != nil {
+			target.Close()
+			continue
+		}
+		go ssh.DiscardRequests(creqs)
+		go func() {
+			defer ch.Close()
+			defer target.Close()
+			go io.Copy(target, ch)
+			io.Copy(ch, target)
+		}()
+	}
+}
+
+// echoServer returns the address of a TCP server that echoes what it reads.
+func echoServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				io.Copy(c, c)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// env isolates HOME and SSH_AUTH_SOCK so the developer's own keys and agent are not used.
+func env(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SSH_AUTH_SOCK", "")
+	return home
+}
+
+func writeKnownHosts(t *testing.T, dir, addr string, keys ...ssh.PublicKey) string {
+	t.Helper()
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(knownhosts.Line([]string{knownhosts.Normalize(addr)}, k) + "\n")
+	}
+	path := filepath.Join(dir, "known_hosts")
+	if err := os.WriteFile(path, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeKey(t *testing.T, dir string, key any) string {
+	t.Helper()
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "id_test")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// fixture is a running server with a client key file and a known_hosts file that trusts its first host key.
+type fixture struct {
+	srv        *server
+	keyFile    string
+	knownHosts string
+}
+
+func newFixture(t *testing.T) fixture {
+	t.Helper()
+	dir := env(t)
+	clientSigner, clientKey := newSigner(t, false)
+	hostKey, _ := newSigner(t, false)
+	srv := startServer(t, clientSigner.PublicKey(), hostKey)
+	return fixture{
+		srv:        srv,
+		keyFile:    writeKey(t, dir, clientKey),
+		knownHosts: writeKnownHosts(t, dir, srv.addr, hostKey.PublicKey()),
+	}
+}
+
+func (f fixture) open() (*Tunnel, error) {
+	return Open(Options{Target: "tester@" + f.srv.addr, KeyFile: f.keyFile, KnownHosts: f.knownHosts, Timeout: 5 * time.Second})
+}
+
+func roundTrip(t *testing.T, c net.Conn) {
+	t.Helper()
+	defer c.Close()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "ping" {
+		t.Fatalf("echo = %q, want ping", buf)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, tc := range []struct{ in, user, addr string }{
+		{"alice@bastion", "alice", "bastion:22"},
+		{"alice@bastion:2222", "alice", "bastion:2222"},
+		{"alice@[::1]", "alice", "[::1]:22"},
+	} {
+		user, addr, err := ParseTarget(tc.in)
+		if err != nil || user != tc.user || addr != tc.addr {
+			t.Errorf("ParseTarget(%q) = %q, %q, %v; want %q, %q", tc.in, user, addr, err, tc.user, tc.addr)
+		}
+	}
+	if _, _, err := ParseTarget("alice@"); err == nil {
+		t.Error("ParseTarget(alice@) succeeded")
+	}
+}
+
+func TestOpenKnownHost(t *testing.T) {
+	f := newFixture(t)
+	tun, err := f.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.Close()
+}
+
+func TestOpenUnknownHost(t *testing.T) {
+	f := newFixture(t)
+	other, _ := newSigner(t, false)
+	f.knownHosts = writeKnownHosts(t, t.TempDir(), "127.0.0.1:1", other.PublicKey())
+	_, err := f.open()
+	if err == nil || !strings.Contains(err.Error(), "host key is not in") {
+		t.Fatalf("err = %v, want unknown host", err)
+	}
+}
+
+func TestOpenHostKeyMismatch(t *testing.T) {
+	f := newFixture(t)
+	other, _ := newSigner(t, false)
+	f.knownHosts = writeKnownHosts(t, t.TempDir(), f.srv.addr, other.PublicKey())
+	_, err := f.open()
+	if err == nil || !strings.Contains(err.Error(), "HOST KEY MISMATCH") {
+		t.Fatalf("err = %v, want mismatch", err)
+	}
+}
+
+// The client negotiates the server's RSA key first while known_hosts only records its ed25519 key;
+// Open retries asking for ed25519.
+func TestOpenHostKeyAlgorithmsRetry(t *testing.T) {
+	dir := env(t)
+	clientSigner, clientKey := newSigner(t, false)
+	edHost, _ := newSigner(t, false)
+	rsaHost, _ := newSigner(t, true)
+	srv := startServer(t, clientSigner.PublicKey(), edHost, rsaHost)
+	f := fixture{srv: srv, keyFile: writeKey(t, dir, clientKey), knownHosts: writeKnownHosts(t, dir, srv.addr, edHost.PublicKey())}
+	tun, err := f.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.Close()
+}
+
+func TestOpenKeyFileRejected(t *testing.T) {
+	f := newFixture(t)
+	_, stranger := newSigner(t, false)
+	f.keyFile = writeKey(t, t.TempDir(), stranger)
+	if _, err := f.open(); err == nil {
+		t.Fatal("Open succeeded with a key the server does not accept")
+	}
+}
+
+func TestOpenAgent(t *testing.T) {
+	f := newFixture(t)
+	block, err := os.ReadFile(f.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.ParseRawPrivateKey(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				agent.ServeAgent(keyring, c)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	f.keyFile = ""
+	tun, err := f.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tun.Close()
+}
+
+func TestOpenNoCredentials(t *testing.T) {
+	f := newFixture(t)
+	f.keyFile = ""
+	_, err := f.open()
+	if err == nil || !strings.Contains(err.Error(), "no ssh credentials") {
+		t.Fatalf("err = %v, want no credentials", err)
+	}
+}
+
+func TestDial(t *testing.T) {
+	f := newFixture(t)
+	tun, err := f.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+	c, err := tun.DialTimeout("tcp", echoServer(t), 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roundTrip(t, c)
+}
+
+func TestForward(t *testing.T) {
+	f := newFixture(t)
+	tun, err := f.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tun.Close()
+	local, closer, err := tun.Forward(echoServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := net.Dial("tcp", local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := c.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(c, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("echo = %q, %v", buf, err)
+	}
+
+	// Only the first connection is relayed; the port is closed after it.
+	if second, err := net.DialTimeout("tcp", local, time.Second); err == nil {
+		second.Close()
+		t.Error("a second connection to the forward was accepted")
+	}
+
+	closer.Close()
+	if _, err := c.Read(buf); err == nil {
+		t.Error("relayed connection still open after Close")
+	}
+}